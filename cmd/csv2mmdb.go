@@ -2,18 +2,32 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	// embed the time zone database, for `timezone` of timestamp fields
+	_ "time/tzdata"
 
 	"github.com/fholzer/csv2mmdb/pkg/convert"
+	"golang.org/x/term"
 )
 
 func main() {
-	input := flag.String("input", "", "Path to the CSV input file (REQUIRED)")
+	input := flag.String("input", "", "Path to the CSV or JSON Lines input file (REQUIRED)")
 	output := flag.String("output", "", "Path to the mmdb output file (REQUIRED)")
 	configFilePath := flag.String("config", "", "Path to the configuration file (REQUIRED)")
+	inputFormat := flag.String("input-format", "", "Format of the input file: csv or jsonl. Overrides inputFormat of the configuration file (default: csv)")
+	workers := flag.Int("workers", 0, "Number of goroutines mapping rows concurrently (default: the number of CPUs)")
+	missReportPath := flag.String("miss-report", "", "Path to a file the report of untranslatable and invalid values is written to, in JSON format")
+	statsFormat := flag.String("stats", "", "Print conversion statistics to stderr, in the given format: text or json")
+	logFormat := flag.String("log-format", "text", "Format of log messages: text or json")
+	logLevel := flag.String("log-level", "info", "Minimum level of log messages: debug, info, warn or error")
+	quiet := flag.Bool("quiet", false, "Only log errors, and don't show a progress bar")
 
 	flag.Parse()
 
@@ -31,6 +45,26 @@ func main() {
 		errors = append(errors, "Your output file must be different than your block file(input file).")
 	}
 
+	if *inputFormat != "" && *inputFormat != convert.InputFormatCSV && *inputFormat != convert.InputFormatJSONL {
+		errors = append(errors, "-input-format must be either csv or jsonl")
+	}
+
+	if *statsFormat != "" && *statsFormat != "text" && *statsFormat != "json" {
+		errors = append(errors, "-stats must be either text or json")
+	}
+
+	if *logFormat != "text" && *logFormat != "json" {
+		errors = append(errors, "-log-format must be either text or json")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		errors = append(errors, "-log-level must be one of debug, info, warn or error")
+	}
+	if *quiet {
+		level = slog.LevelError
+	}
+
 	args := flag.Args()
 	if len(args) > 0 {
 		errors = append(errors, "unknown argument(s): "+strings.Join(args, ", "))
@@ -41,19 +75,107 @@ func main() {
 		os.Exit(1)
 	}
 
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	var logger *slog.Logger
+	if *logFormat == "json" {
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, handlerOptions))
+	} else {
+		logger = slog.New(slog.NewTextHandler(os.Stderr, handlerOptions))
+	}
+
 	config, err := convert.NewConfig(*configFilePath)
 	if err != nil {
-		fmt.Printf("Error reading config file: %v\n", err)
+		logger.Error("error reading config file", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
+	if *inputFormat != "" {
+		config.InputFormat = *inputFormat
+	}
+	if *workers > 0 {
+		config.Workers = *workers
+	}
+
+	opts := &convert.ConverterOptions{
+		Logger: logger,
+		// the progress bar would garble log files and CI output
+		ShowProgress: !*quiet && term.IsTerminal(int(os.Stderr.Fd())),
+	}
 
-	err = convert.ConvertFile(config, *input, *output)
+	// cancel the conversion on the first signal; once stop is called, a
+	// second signal terminates the process right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	stats, err := convert.ConvertFileContext(ctx, config, *input, *output, opts)
+	cancelled := ctx.Err() != nil
+	stop()
+	if err != nil && cancelled {
+		// don't leave a partial database behind
+		if rerr := os.Remove(*output); rerr != nil && !os.IsNotExist(rerr) {
+			logger.Error("error removing partial output file", slog.String("error", rerr.Error()))
+		}
+		logger.Error("conversion cancelled")
+		os.Exit(1)
+	}
+	if stats != nil {
+		if rerr := writeMissReport(logger, stats.Misses, *missReportPath, *logFormat == "text" && !*quiet); rerr != nil {
+			logger.Error("error writing miss report", slog.String("error", rerr.Error()))
+		}
+		if serr := writeStats(stats, *statsFormat); serr != nil {
+			logger.Error("error writing stats", slog.String("error", serr.Error()))
+		}
+	}
 	if err != nil {
-		fmt.Fprintf(flag.CommandLine.Output(), "Error: %v\n", err)
+		logger.Error("conversion failed", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
 }
 
+// writeStats prints the stats in `format`, if a format is given.
+func writeStats(stats *convert.ConversionStats, format string) error {
+	switch format {
+	case "text":
+		return stats.WriteText(os.Stderr)
+	case "json":
+		return stats.WriteJSON(os.Stderr)
+	}
+	return nil
+}
+
+// writeMissReport prints a summary of the report, if there is anything to
+// report, and writes it to `path` in JSON format, if a path is given. The
+// summary is printed as table if `table` is true, and logged otherwise.
+func writeMissReport(logger *slog.Logger, report *convert.MissReport, path string, table bool) error {
+	if !report.Empty() {
+		if table {
+			fmt.Fprintln(flag.CommandLine.Output(), "Some values couldn't be translated or converted:")
+			if err := report.WriteTable(flag.CommandLine.Output()); err != nil {
+				return err
+			}
+		} else {
+			for _, fm := range report.Fields {
+				logger.Warn("values couldn't be translated or converted",
+					slog.String("field", fm.Field),
+					slog.String("target", fm.Target),
+					slog.String("kind", fm.Kind),
+					slog.Uint64("count", fm.Count))
+			}
+		}
+	}
+
+	if path == "" {
+		return nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return report.WriteJSON(file)
+}
+
 func printHelp(errors []string) {
 	var passedFlags []string
 	flag.Visit(func(f *flag.Flag) {
@@ -0,0 +1,126 @@
+package convert
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+const (
+	CapitalizationLower      = "lower"
+	CapitalizationUpper      = "upper"
+	CapitalizationTitle      = "title"
+	CapitalizationSmartTitle = "smartTitle"
+)
+
+// defaultLowercaseWords lists name particles and short words which are kept
+// lower-case by smart title-casing, unless they start the value.
+var defaultLowercaseWords = []string{
+	"a", "an", "and", "at", "da", "das", "de", "del", "della", "den", "der",
+	"des", "di", "do", "dos", "du", "el", "en", "et", "for", "in", "la",
+	"le", "of", "on", "or", "te", "ten", "ter", "the", "to", "und", "van",
+	"von", "y", "zu",
+}
+
+// defaultUppercaseWords lists common acronyms of place and organization
+// names, which are kept upper-case by smart title-casing.
+var defaultUppercaseWords = []string{
+	"dc", "eu", "llc", "plc", "prc", "uae", "uk", "usa",
+}
+
+// capitalizer changes the capitalization of strings.
+type capitalizer interface {
+	String(string) string
+}
+
+// newCapitalizer creates the capitalizer for the field's capitalization mode
+// and locale. It returns nil if the field's capitalization is to be left
+// unchanged.
+func newCapitalizer(fc *FieldConfig) (capitalizer, error) {
+	tag := language.English
+	if fc.Locale != "" {
+		var err error
+		if tag, err = language.Parse(fc.Locale); err != nil {
+			return nil, fmt.Errorf("unknown locale '%s' for field '%s'", fc.Locale, fc.Name)
+		}
+	}
+
+	switch fc.Capitalization {
+	case "":
+		return nil, nil
+	case CapitalizationLower:
+		return cases.Lower(tag), nil
+	case CapitalizationUpper:
+		return cases.Upper(tag), nil
+	case CapitalizationTitle:
+		return cases.Title(tag), nil
+	case CapitalizationSmartTitle:
+		return newSmartTitleCaser(tag, fc.LowercaseWords, fc.UppercaseWords), nil
+	default:
+		return nil, fmt.Errorf("unknown capitalization mode '%s' for field '%s'", fc.Capitalization, fc.Name)
+	}
+}
+
+// smartTitleCaser title-cases strings, but keeps particles such as "de" or
+// "van" lower-case and acronyms upper-case.
+type smartTitleCaser struct {
+	title cases.Caser
+	lower cases.Caser
+	upper cases.Caser
+	// lowercaseWords and uppercaseWords are keyed by lower-cased words
+	lowercaseWords map[string]bool
+	uppercaseWords map[string]bool
+}
+
+func newSmartTitleCaser(tag language.Tag, lowercaseWords []string, uppercaseWords []string) *smartTitleCaser {
+	if lowercaseWords == nil {
+		lowercaseWords = defaultLowercaseWords
+	}
+	if uppercaseWords == nil {
+		uppercaseWords = defaultUppercaseWords
+	}
+
+	c := &smartTitleCaser{
+		title:          cases.Title(tag),
+		lower:          cases.Lower(tag),
+		upper:          cases.Upper(tag),
+		lowercaseWords: map[string]bool{},
+		uppercaseWords: map[string]bool{},
+	}
+	for _, w := range lowercaseWords {
+		c.lowercaseWords[c.lower.String(w)] = true
+	}
+	for _, w := range uppercaseWords {
+		c.uppercaseWords[c.lower.String(w)] = true
+	}
+	return c
+}
+
+func (c *smartTitleCaser) String(s string) string {
+	words := strings.Split(c.title.String(s), " ")
+	first := true
+	for i, w := range words {
+		// ignore surrounding punctuation, e.g. in "(usa)"
+		start := strings.IndexFunc(w, isWordRune)
+		if start < 0 {
+			continue
+		}
+		end := strings.LastIndexFunc(w, isWordRune) + 1
+		core := c.lower.String(w[start:end])
+
+		if c.uppercaseWords[core] {
+			words[i] = w[:start] + c.upper.String(core) + w[end:]
+		} else if !first && c.lowercaseWords[core] {
+			words[i] = w[:start] + core + w[end:]
+		}
+		first = false
+	}
+	return strings.Join(words, " ")
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
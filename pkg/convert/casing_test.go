@@ -0,0 +1,39 @@
+package convert
+
+import (
+	"testing"
+)
+
+func TestSmartTitle(t *testing.T) {
+	tests := []struct {
+		field string
+		input string
+		want  string
+	}{
+		{"", "united states of america", "United States of America"},
+		{"", "THE NETHERLANDS", "The Netherlands"},
+		{"", "usa", "USA"},
+		{"", "washington, dc (usa)", "Washington, DC (USA)"},
+		{"", "acme corp llc", "Acme Corp LLC"},
+		{"", "ludwig van beethoven", "Ludwig van Beethoven"},
+		{"uppercaseWords: [nyc]", "nyc usa", "NYC Usa"},
+		{"uppercaseWords: []", "usa", "Usa"},
+		{"lowercaseWords: [de]\nuppercaseWords: []", "van de graaf", "Van de Graaf"},
+		{"locale: nl", "ijsselmeer", "IJsselmeer"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			m, err := NewBaseFieldMapper(testFieldConfig(t, "capitalization: smartTitle\n"+test.field))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := m.Preprocess(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
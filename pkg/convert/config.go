@@ -3,18 +3,81 @@ package convert
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	InvalidModeError      = "error"
+	InvalidModeOmitValue  = "omitValue"
+	InvalidModeOmitRecord = "omitRecord"
+)
+
+const (
+	EncodingHex       = "hex"
+	EncodingBase64    = "base64"
+	EncodingBase64URL = "base64url"
+)
+
+// normalizationForms maps the supported `normalize` values to the
+// corresponding Unicode normalization forms.
+var normalizationForms = map[string]norm.Form{
+	"NFC":  norm.NFC,
+	"NFD":  norm.NFD,
+	"NFKC": norm.NFKC,
+	"NFKD": norm.NFKD,
+}
+
+const (
+	RoundingModeHalfAwayFromZero = "halfAwayFromZero"
+	RoundingModeHalfEven         = "halfEven"
+	RoundingModeTowardZero       = "towardZero"
+	RoundingModeFloor            = "floor"
+	RoundingModeCeil             = "ceil"
+)
+
+const (
+	EmptyModeFalse     = "false"
+	EmptyModeOmitValue = "omitValue"
+	EmptyModeError     = "error"
+)
+
+// LanguagePlaceholder is replaced by each of a field's languages in the
+// field's name and target.
+const LanguagePlaceholder = "{lang}"
+
 type Config struct {
 	DatabaseType  string         `yaml:"databaseType"`
 	RecordSize    uint8          `yaml:"recordSize"`
 	UseValueCache bool           `yaml:"useValueCache"`
+	InputFormat   string         `yaml:"inputFormat"`
+	Workers       int            `yaml:"workers"`
+	BoundedMemory bool           `yaml:"boundedMemory"`
+	TempDir       string         `yaml:"tempDir"`
+	Languages     []string       `yaml:"languages"`
 	Fields        []*FieldConfig `yaml:"fields"`
 }
 
 func (c *Config) Validate() error {
+	if c.InputFormat != "" && c.InputFormat != InputFormatCSV && c.InputFormat != InputFormatJSONL {
+		return fmt.Errorf("unknown input format '%s', supported formats are: %s, %s", c.InputFormat, InputFormatCSV, InputFormatJSONL)
+	}
+
+	fields, err := expandTargets(c.Fields)
+	if err != nil {
+		return err
+	}
+	if fields, err = c.expandLanguages(fields); err != nil {
+		return err
+	}
+	c.Fields = fields
+
 	for _, f := range c.Fields {
 		if err := f.Validate(); err != nil {
 			return err
@@ -24,40 +87,379 @@ func (c *Config) Validate() error {
 }
 
 type FieldConfig struct {
-	Name           string            `yaml:"name"`
-	Target         string            `yaml:"target"`
-	Type           string            `yaml:"type"`
-	Capitalization string            `yaml:"capitalization"`
-	Translate      map[string]string `yaml:"translate"`
-	IgnoreEmpty    bool              `yaml:"ignoreEmpty"`
-	Critical       bool              `yaml:"critical"`
-	OmitZeroValue  bool              `yaml:"omitZeroValue"`
-	FieldMapper    FieldMapper
+	Name               string            `yaml:"name"`
+	Target             string            `yaml:"target"`
+	Type               string            `yaml:"type"`
+	Capitalization     string            `yaml:"capitalization"`
+	Locale             string            `yaml:"locale"`
+	LowercaseWords     []string          `yaml:"lowercaseWords"`
+	UppercaseWords     []string          `yaml:"uppercaseWords"`
+	Trim               bool              `yaml:"trim"`
+	Extract            string            `yaml:"extract"`
+	Replace            []*ReplaceConfig  `yaml:"replace"`
+	Translate          *TranslationTable `yaml:"translate"`
+	TranslateMode      string            `yaml:"translateMode"`
+	TranslateDefault   *string           `yaml:"translateDefault"`
+	InvalidMode        string            `yaml:"invalidMode"`
+	IgnoreEmpty        bool              `yaml:"ignoreEmpty"`
+	Critical           bool              `yaml:"critical"`
+	OmitZeroValue      bool              `yaml:"omitZeroValue"`
+	TrueValues         []string          `yaml:"trueValues"`
+	FalseValues        []string          `yaml:"falseValues"`
+	EmptyMode          string            `yaml:"emptyMode"`
+	Encoding           string            `yaml:"encoding"`
+	Layout             Layouts           `yaml:"layout"`
+	TimestampOutput    string            `yaml:"timestampOutput"`
+	Timezone           string            `yaml:"timezone"`
+	Precision          *int              `yaml:"precision"`
+	RoundingMode       string            `yaml:"roundingMode"`
+	AllowFloat32       bool              `yaml:"allowFloat32"`
+	Min                *float64          `yaml:"min"`
+	Max                *float64          `yaml:"max"`
+	Enum               []string          `yaml:"enum"`
+	Pattern            string            `yaml:"pattern"`
+	Normalize          string            `yaml:"normalize"`
+	Transliterate      bool              `yaml:"transliterate"`
+	CollapseWhitespace bool              `yaml:"collapseWhitespace"`
+	Default            *string           `yaml:"default"`
+	Fallback           string            `yaml:"fallback"`
+	Languages          []string          `yaml:"languages"`
+	FallbackLanguage   string            `yaml:"fallbackLanguage"`
+	Options            yaml.Node         `yaml:"options"`
+	Targets            []yaml.Node       `yaml:"targets"`
+	FieldMapper        FieldMapper
+}
+
+// DecodeOptions decodes the field's `options` into `v`. This allows field
+// types registered using RegisterFieldMapper to accept arbitrary, typed
+// configuration. If no options are given, `v` is left untouched.
+func (f *FieldConfig) DecodeOptions(v interface{}) error {
+	if f.Options.IsZero() {
+		return nil
+	}
+	if err := f.Options.Decode(v); err != nil {
+		return errors.Wrapf(err, "invalid options for field '%s'", f.Name)
+	}
+	return nil
+}
+
+// ReplaceConfig describes the replacement of all matches of a regular
+// expression within a source value. The replacement may refer to capture
+// groups, see regexp.Regexp.Expand.
+type ReplaceConfig struct {
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"`
+}
+
+// expandTargets replaces each FieldConfig that lists multiple targets with
+// one FieldConfig per target, so the rest of the conversion only ever deals
+// with a single target per FieldConfig. Each target is decoded on top of a
+// copy of the FieldConfig, so it may specify any property but `name` and
+// `targets`, overriding the field's own.
+func expandTargets(fields []*FieldConfig) ([]*FieldConfig, error) {
+	var res []*FieldConfig
+	for _, f := range fields {
+		if len(f.Targets) == 0 {
+			res = append(res, f)
+			continue
+		}
+		if f.Target != "" {
+			return nil, fmt.Errorf("field '%s' must not specify both 'target' and 'targets'", f.Name)
+		}
+
+		for i := range f.Targets {
+			fc := *f
+			fc.Targets = nil
+			if err := decodeTarget(&f.Targets[i], &fc); err != nil {
+				return nil, errors.Wrapf(err, "invalid entry in 'targets' of field '%s'", f.Name)
+			}
+			if fc.Target == "" {
+				return nil, fmt.Errorf("missing target in 'targets' of field '%s'", f.Name)
+			}
+			res = append(res, &fc)
+		}
+	}
+	return res, nil
+}
+
+// decodeTarget decodes the entry `node` of a field's targets on top of `fc`.
+// The properties given by the entry are reset before, so that pointers,
+// slices and maps aren't shared with, or merged into, those of the field.
+func decodeTarget(node *yaml.Node, fc *FieldConfig) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping", node.Line)
+	}
+
+	v := reflect.ValueOf(fc).Elem()
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if key == "name" || key == "targets" {
+			return fmt.Errorf("line %d: '%s' can't be given for a target", node.Content[i].Line, key)
+		}
+		found := false
+		for j := 0; j < v.NumField(); j++ {
+			if tag, _, _ := strings.Cut(v.Type().Field(j).Tag.Get("yaml"), ","); tag == key {
+				v.Field(j).Set(reflect.Zero(v.Field(j).Type()))
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("line %d: unknown property '%s'", node.Content[i].Line, key)
+		}
+	}
+	return node.Decode(fc)
+}
+
+// expandLanguages replaces each FieldConfig whose name or target contains
+// the LanguagePlaceholder with one FieldConfig per language. Fields use the
+// config's languages, unless they specify their own. All languages used are
+// added to the config's languages, which end up in the database metadata.
+func (c *Config) expandLanguages(fields []*FieldConfig) ([]*FieldConfig, error) {
+	var res []*FieldConfig
+	for _, f := range fields {
+		if !strings.Contains(f.Name, LanguagePlaceholder) && !strings.Contains(f.Target, LanguagePlaceholder) {
+			res = append(res, f)
+			continue
+		}
+
+		languages := f.Languages
+		if languages == nil {
+			languages = c.Languages
+		}
+		if len(languages) == 0 {
+			return nil, fmt.Errorf("field '%s' uses '%s', but no languages are configured", f.Name, LanguagePlaceholder)
+		}
+
+		for _, lang := range languages {
+			fc := *f
+			fc.Name = strings.ReplaceAll(f.Name, LanguagePlaceholder, lang)
+			fc.Target = strings.ReplaceAll(f.Target, LanguagePlaceholder, lang)
+			fc.Languages = nil
+			fc.FallbackLanguage = ""
+			if f.FallbackLanguage != "" && f.FallbackLanguage != lang {
+				fc.Fallback = strings.ReplaceAll(f.Name, LanguagePlaceholder, f.FallbackLanguage)
+			}
+			res = append(res, &fc)
+			c.addLanguage(lang)
+		}
+	}
+	return res, nil
+}
+
+func (c *Config) addLanguage(lang string) {
+	for _, l := range c.Languages {
+		if l == lang {
+			return
+		}
+	}
+	c.Languages = append(c.Languages, lang)
+}
+
+// typeOptions lists the properties only supported by some of the built-in
+// types, along with these types. Types registered using RegisterFieldMapper
+// may use any of them.
+var typeOptions = []struct {
+	name  string
+	types []string
+	isSet func(f *FieldConfig) bool
+}{
+	{"trueValues", []string{"boolean"}, func(f *FieldConfig) bool { return f.TrueValues != nil }},
+	{"falseValues", []string{"boolean"}, func(f *FieldConfig) bool { return f.FalseValues != nil }},
+	{"emptyMode", []string{"boolean"}, func(f *FieldConfig) bool { return f.EmptyMode != "" }},
+	{"encoding", []string{"bytes"}, func(f *FieldConfig) bool { return f.Encoding != "" }},
+	{"layout", []string{"timestamp"}, func(f *FieldConfig) bool { return f.Layout != nil }},
+	{"timestampOutput", []string{"timestamp"}, func(f *FieldConfig) bool { return f.TimestampOutput != "" }},
+	{"timezone", []string{"timestamp"}, func(f *FieldConfig) bool { return f.Timezone != "" }},
+	{"precision", []string{"float32", "float64"}, func(f *FieldConfig) bool { return f.Precision != nil }},
+	{"roundingMode", []string{"float32", "float64"}, func(f *FieldConfig) bool { return f.RoundingMode != "" }},
+	{"allowFloat32", []string{"float64"}, func(f *FieldConfig) bool { return f.AllowFloat32 }},
+}
+
+// supportsTypeOption reports whether the field's type supports the property
+// `name` of typeOptions.
+func (f *FieldConfig) supportsTypeOption(name string) bool {
+	if !builtinFieldMapperTypes[f.Type] {
+		return true
+	}
+	for _, o := range typeOptions {
+		if o.name != name {
+			continue
+		}
+		for _, t := range o.types {
+			if t == f.Type {
+				return true
+			}
+		}
+		return false
+	}
+	return true
 }
 
 func (f *FieldConfig) Validate() error {
 	if f.Type == "" {
 		f.Type = "string"
 	}
-	switch f.Type {
-	case "string":
-	case "int32":
-	case "uint32":
-	case "int64":
-	case "uint64":
-	case "boolean":
-	case "float32":
+	// checked before any defaults are applied
+	for _, o := range typeOptions {
+		if o.isSet(f) && !f.supportsTypeOption(o.name) {
+			return fmt.Errorf("field '%s' of type '%s' must not have '%s'", f.Name, f.Type, o.name)
+		}
+	}
+	if _, err := newCapitalizer(f); err != nil {
+		return err
+	}
+
+	if f.Extract != "" {
+		if _, err := regexp.Compile(f.Extract); err != nil {
+			return errors.Wrapf(err, "invalid extract pattern for field '%s'", f.Name)
+		}
+	}
+	for _, r := range f.Replace {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return errors.Wrapf(err, "invalid replace pattern for field '%s'", f.Name)
+		}
+	}
+
+	if f.Precision != nil && (*f.Precision < 0 || *f.Precision > 15) {
+		return fmt.Errorf("precision %d for field '%s' is out of range 0 to 15", *f.Precision, f.Name)
+	}
+	if f.RoundingMode == "" && f.supportsTypeOption("roundingMode") {
+		f.RoundingMode = RoundingModeHalfAwayFromZero
+	}
+	switch f.RoundingMode {
+	case "":
+	case RoundingModeHalfAwayFromZero:
+	case RoundingModeHalfEven:
+	case RoundingModeTowardZero:
+	case RoundingModeFloor:
+	case RoundingModeCeil:
+	default:
+		return fmt.Errorf("unknown rounding mode '%s' for field '%s'", f.RoundingMode, f.Name)
+	}
+	if f.AllowFloat32 && f.Precision == nil {
+		return fmt.Errorf("'allowFloat32' requires 'precision' for field '%s'", f.Name)
+	}
+
+	if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+		return fmt.Errorf("minimum %v is greater than maximum %v for field '%s'", *f.Min, *f.Max, f.Name)
+	}
+	if f.Pattern != "" {
+		if _, err := regexp.Compile(f.Pattern); err != nil {
+			return errors.Wrapf(err, "invalid pattern for field '%s'", f.Name)
+		}
+	}
+
+	if f.Translate != nil && f.Translate.Values == nil {
+		return fmt.Errorf("translation file '%s' for field '%s' has not been loaded", f.Translate.File, f.Name)
+	}
+
+	if f.TranslateMode == "" {
+		f.TranslateMode = TranslateModePassthrough
+	}
+	switch f.TranslateMode {
+	case TranslateModePassthrough:
+	case TranslateModeDefault:
+		if f.TranslateDefault == nil {
+			return fmt.Errorf("translate mode '%s' requires 'translateDefault' for field '%s'", f.TranslateMode, f.Name)
+		}
+	case TranslateModeOmitValue:
+	case TranslateModeOmitRecord:
+	case TranslateModeError:
 	default:
-		return fmt.Errorf("unknown field type '%s' for field '%s'", f.Type, f.Name)
+		return fmt.Errorf("unknown translate mode '%s' for field '%s'", f.TranslateMode, f.Name)
 	}
 
-	switch f.Capitalization {
+	if f.InvalidMode == "" {
+		f.InvalidMode = InvalidModeError
+	}
+	switch f.InvalidMode {
+	case InvalidModeError:
+	case InvalidModeOmitValue:
+	case InvalidModeOmitRecord:
+	default:
+		return fmt.Errorf("unknown invalid mode '%s' for field '%s'", f.InvalidMode, f.Name)
+	}
+
+	switch f.Encoding {
 	case "":
-	case "lower":
-	case "upper":
-	case "title":
+	case EncodingHex:
+	case EncodingBase64:
+	case EncodingBase64URL:
 	default:
-		return fmt.Errorf("unknown capitalization mode '%s' for fiel '%s'", f.Capitalization, f.Name)
+		return fmt.Errorf("unknown encoding '%s' for field '%s'", f.Encoding, f.Name)
+	}
+
+	if err := f.validateTimestamp(); err != nil {
+		return err
+	}
+	if (f.Min != nil || f.Max != nil) && !f.hasNumericValues() {
+		return fmt.Errorf("field '%s' of type '%s' must not have a minimum or maximum", f.Name, f.Type)
+	}
+
+	if _, ok := normalizationForms[f.Normalize]; !ok && f.Normalize != "" {
+		return fmt.Errorf("unknown normalization form '%s' for field '%s'", f.Normalize, f.Name)
+	}
+
+	if f.EmptyMode == "" && f.supportsTypeOption("emptyMode") {
+		f.EmptyMode = EmptyModeFalse
+	}
+	switch f.EmptyMode {
+	case "":
+	case EmptyModeFalse:
+	case EmptyModeOmitValue:
+	case EmptyModeError:
+	default:
+		return fmt.Errorf("unknown empty mode '%s' for field '%s'", f.EmptyMode, f.Name)
+	}
+
+	for _, tv := range f.TrueValues {
+		for _, fv := range f.FalseValues {
+			if strings.EqualFold(tv, fv) {
+				return fmt.Errorf("value '%s' is listed in both 'trueValues' and 'falseValues' of field '%s'", tv, f.Name)
+			}
+		}
+	}
+
+	// make sure the field type exists and accepts the configuration
+	fm, err := NewFieldMapper(f)
+	if err != nil {
+		return err
+	}
+
+	// make sure translated values can be converted to the field's type
+	if f.Translate != nil {
+		// translated values are only capitalized; trimming, normalization,
+		// extraction and replacements are applied to the source value before
+		// translation
+		plain := *f
+		plain.Trim = false
+		plain.Normalize = ""
+		plain.Transliterate = false
+		plain.CollapseWhitespace = false
+		plain.Extract = ""
+		plain.Replace = nil
+		plain.Translate = nil
+		plainMapper, err := NewFieldMapper(&plain)
+		if err != nil {
+			return err
+		}
+		for k, v := range f.Translate.Values {
+			if _, err := plainMapper.Map(v); err != nil {
+				return errors.Wrapf(err, "invalid translation of '%s' for field '%s'", k, f.Name)
+			}
+		}
+		if f.TranslateDefault != nil {
+			if _, err := plainMapper.Map(*f.TranslateDefault); err != nil {
+				return errors.Wrapf(err, "invalid translateDefault for field '%s'", f.Name)
+			}
+		}
+	}
+
+	// make sure the default value can be converted to the field's type
+	if f.Default != nil {
+		if _, err := fm.Map(*f.Default); err != nil {
+			return errors.Wrapf(err, "invalid default value for field '%s'", f.Name)
+		}
 	}
 	return nil
 }
@@ -82,6 +484,18 @@ func NewConfig(filePath string) (*Config, error) {
 		return nil, err
 	}
 
+	// Load translation tables referenced by file name, including those of
+	// targets
+	if config.Fields, err = expandTargets(config.Fields); err != nil {
+		return nil, err
+	}
+	loader := newTranslationLoader(filepath.Dir(filePath))
+	for _, f := range config.Fields {
+		if err := loader.Load(f.Translate); err != nil {
+			return nil, errors.Wrapf(err, "error loading translations for field '%s'", f.Name)
+		}
+	}
+
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
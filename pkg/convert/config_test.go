@@ -0,0 +1,170 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testNewConfig writes `config` and `files`, keyed by name, to a temporary
+// directory, and reads the config using NewConfig.
+func testNewConfig(t *testing.T, config string, files map[string]string) (*Config, error) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configPath := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return NewConfig(configPath)
+}
+
+func TestExpandTargets(t *testing.T) {
+	config, err := testNewConfig(t, `
+fields:
+  - name: country
+    capitalization: upper
+    critical: true
+    default: "at"
+    translate:
+      austria: "at"
+    targets:
+      - target: country.iso_code
+      - target: country.names.en
+        capitalization: title
+        critical: false
+        default: "Austria"
+        translate:
+          at: "austria"
+      - target: country.code_length
+        type: uint32
+        capitalization: ""
+        default: "2"
+        translate: lengths.json
+`, map[string]string{"lengths.json": `{"austria": 2}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Fields) != 3 {
+		t.Fatalf("got %d fields, want 3", len(config.Fields))
+	}
+	code, name, length := config.Fields[0], config.Fields[1], config.Fields[2]
+	if code.Target != "country.iso_code" || code.Capitalization != "upper" || !code.Critical || *code.Default != "at" || code.Translate.Values["austria"] != "at" {
+		t.Errorf("first target doesn't inherit the field's properties: %+v", code)
+	}
+	if name.Target != "country.names.en" || name.Capitalization != "title" || name.Critical || *name.Default != "Austria" || name.Translate.Values["at"] != "austria" {
+		t.Errorf("second target doesn't override the field's properties: %+v", name)
+	}
+	if _, ok := code.Translate.Values["at"]; ok {
+		t.Error("translations of the second target were merged into those of the field")
+	}
+	if length.Type != "uint32" || length.Capitalization != "" || length.Translate.Values["austria"] != "2" {
+		t.Errorf("third target doesn't override the field's properties: %+v", length)
+	}
+}
+
+func TestExpandTargetsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		err    string
+	}{
+		{"name", "{target: a, name: b}", "'name' can't be given for a target"},
+		{"targets", "{target: a, targets: []}", "'targets' can't be given for a target"},
+		{"unknown", "{target: a, foo: b}", "unknown property 'foo'"},
+		{"missing target", "{type: uint32}", "missing target"},
+		{"scalar", "a", "expected a mapping"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := testNewConfig(t, "fields:\n  - name: f\n    targets: ["+test.target+"]\n", nil)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestTranslationFiles(t *testing.T) {
+	tests := []struct {
+		file    string
+		content string
+		want    map[string]string
+		err     string
+	}{
+		{"t.csv", "austria,2782113\nyes,true\n", map[string]string{"austria": "2782113", "yes": "true"}, ""},
+		{"t.yml", "austria: 2782113\n\"yes\": true\n", map[string]string{"austria": "2782113", "yes": "true"}, ""},
+		{"t.json", `{"austria": 2782113, "yes": true, "ratio": 1.5, "name": "Austria"}`, map[string]string{"austria": "2782113", "yes": "true", "ratio": "1.5", "name": "Austria"}, ""},
+		{"t.json", `{"austria": {"id": 2782113}}`, nil, "translation of 'austria' must be a string, number or boolean"},
+		{"t.json", `{"austria": null}`, nil, "translation of 'austria' must be a string, number or boolean"},
+		{"t.txt", "", nil, "unsupported translation file type '.txt'"},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			config, err := testNewConfig(t, "fields:\n  - name: f\n    target: f\n    translate: "+test.file+"\n", map[string]string{test.file: test.content})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := config.Fields[0].Translate.Values; !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateTypeOptions(t *testing.T) {
+	tests := []struct {
+		field string
+		err   string
+	}{
+		{"type: string", ""},
+		{"type: boolean\ntrueValues: [y]\nfalseValues: [n]\nemptyMode: omitValue", ""},
+		{"type: string\ntrueValues: [y]", "field 'f' of type 'string' must not have 'trueValues'"},
+		{"type: string\nfalseValues: [n]", "must not have 'falseValues'"},
+		{"type: string\nemptyMode: omitValue", "must not have 'emptyMode'"},
+		{"type: bytes\nencoding: base64", ""},
+		{"type: uint32\nencoding: hex", "field 'f' of type 'uint32' must not have 'encoding'"},
+		{"type: timestamp\nlayout: unix\ntimestampOutput: iso8601\ntimezone: Europe/Vienna", ""},
+		{"type: string\nlayout: unix", "must not have 'layout'"},
+		{"type: uint64\ntimestampOutput: epoch", "must not have 'timestampOutput'"},
+		{"type: string\ntimezone: UTC", "must not have 'timezone'"},
+		{"type: float32\nprecision: 2\nroundingMode: floor", ""},
+		{"type: float64\nprecision: 2\nallowFloat32: true", ""},
+		{"type: int32\nprecision: 2", "must not have 'precision'"},
+		{"type: int32\nroundingMode: floor", "must not have 'roundingMode'"},
+		{"type: float32\nprecision: 2\nallowFloat32: true", "field 'f' of type 'float32' must not have 'allowFloat32'"},
+		{"type: string\nmin: 1", "field 'f' of type 'string' must not have a minimum or maximum"},
+	}
+	for _, test := range tests {
+		t.Run(test.field, func(t *testing.T) {
+			field := "  - name: f\n    target: f\n    " + strings.ReplaceAll(test.field, "\n", "\n    ") + "\n"
+			config, err := testNewConfig(t, "fields:\n"+field, nil)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				// defaults of the field's type don't make it invalid
+				if err := config.Validate(); err != nil {
+					t.Fatalf("validating again: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package convert
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/pkg/errors"
+)
+
+// ConstraintError is returned by a FieldMapper if a value was converted
+// successfully, but violates one of the field's constraints.
+type ConstraintError struct {
+	Field   string
+	Message string
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("value of field '%s' %s", e.Field, e.Message)
+}
+
+// newValidators creates the validators enforcing the field's constraints.
+func newValidators(fc *FieldConfig) ([]func(mmdbtype.DataType) error, error) {
+	var validators []func(mmdbtype.DataType) error
+
+	if fc.Min != nil || fc.Max != nil {
+		validators = append(validators, func(v mmdbtype.DataType) error {
+			n, ok := numericValue(v)
+			if !ok {
+				return &ConstraintError{Field: fc.Name, Message: "is not a number, but has a minimum or maximum"}
+			}
+			// NaN compares false to any bound, so it would pass both
+			if math.IsNaN(n) {
+				return &ConstraintError{Field: fc.Name, Message: "is NaN, but has a minimum or maximum"}
+			}
+			if fc.Min != nil && n < *fc.Min {
+				return &ConstraintError{Field: fc.Name, Message: fmt.Sprintf("%v is less than minimum %v", n, *fc.Min)}
+			}
+			if fc.Max != nil && n > *fc.Max {
+				return &ConstraintError{Field: fc.Name, Message: fmt.Sprintf("%v is greater than maximum %v", n, *fc.Max)}
+			}
+			return nil
+		})
+	}
+
+	if len(fc.Enum) > 0 {
+		enum := map[string]bool{}
+		for _, e := range fc.Enum {
+			enum[e] = true
+		}
+		validators = append(validators, func(v mmdbtype.DataType) error {
+			s := stringValue(v)
+			if !enum[s] {
+				return &ConstraintError{Field: fc.Name, Message: fmt.Sprintf("'%s' is not one of %s", s, strings.Join(fc.Enum, ", "))}
+			}
+			return nil
+		})
+	}
+
+	if fc.Pattern != "" {
+		pattern, err := regexp.Compile(fc.Pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern for field '%s'", fc.Name)
+		}
+		validators = append(validators, func(v mmdbtype.DataType) error {
+			s := stringValue(v)
+			if !pattern.MatchString(s) {
+				return &ConstraintError{Field: fc.Name, Message: fmt.Sprintf("'%s' doesn't match pattern '%s'", s, fc.Pattern)}
+			}
+			return nil
+		})
+	}
+
+	return validators, nil
+}
+
+// hasNumericValues reports whether the field's type produces numeric values,
+// which is required for a minimum or maximum. Types registered using
+// RegisterFieldMapper are assumed to do so, and checked for every value.
+func (f *FieldConfig) hasNumericValues() bool {
+	switch f.Type {
+	case "string", "boolean", "bytes", "json":
+		return false
+	case "timestamp":
+		return f.TimestampOutput == TimestampOutputEpoch
+	}
+	return true
+}
+
+// numericValue returns the value of numeric types as float64.
+func numericValue(v mmdbtype.DataType) (float64, bool) {
+	switch t := v.(type) {
+	case mmdbtype.Int32:
+		return float64(t), true
+	case mmdbtype.Uint16:
+		return float64(t), true
+	case mmdbtype.Uint32:
+		return float64(t), true
+	case mmdbtype.Uint64:
+		return float64(t), true
+	case *mmdbtype.Uint128:
+		f, _ := new(big.Float).SetInt((*big.Int)(t)).Float64()
+		return f, true
+	case mmdbtype.Float32:
+		return float64(t), true
+	case mmdbtype.Float64:
+		return float64(t), true
+	}
+	return 0, false
+}
+
+// stringValue returns strings as is, and the default format of other types.
+func stringValue(v mmdbtype.DataType) string {
+	switch t := v.(type) {
+	case mmdbtype.String:
+		return string(t)
+	case *mmdbtype.Uint128:
+		return (*big.Int)(t).String()
+	}
+	return fmt.Sprint(v)
+}
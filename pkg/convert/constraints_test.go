@@ -0,0 +1,52 @@
+package convert
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestConstraints(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		input string
+		// violated is true if the value violates a constraint
+		violated bool
+	}{
+		{"within min and max", "type: float64\nmin: -90\nmax: 90", "45.5", false},
+		{"inclusive min", "type: float64\nmin: -90\nmax: 90", "-90", false},
+		{"inclusive max", "type: float64\nmin: -90\nmax: 90", "90", false},
+		{"less than min", "type: float64\nmin: -90\nmax: 90", "-90.1", true},
+		{"greater than max", "type: float64\nmin: -90\nmax: 90", "90.1", true},
+		{"NaN with min and max", "type: float64\nmin: -90\nmax: 90", "NaN", true},
+		{"NaN with max", "type: float32\nmax: 90", "NaN", true},
+		{"infinity", "type: float64\nmax: 90", "+Inf", true},
+		{"integer", "type: uint32\nmin: 1", "0", true},
+		{"uint128", "type: uint128\nmax: 255", "0x100", true},
+		{"epoch timestamp", "type: timestamp\nlayout: unix\nmax: 1000", "1001", true},
+		{"in enum", "enum: [Cable/DSL, Cellular]", "Cellular", false},
+		{"not in enum", "enum: [Cable/DSL, Cellular]", "cellular", true},
+		{"enum after capitalization", "enum: [Cable/DSL, Cellular]\ncapitalization: title", "cellular", false},
+		{"numeric enum", "type: uint16\nenum: ['80', '443']", "0443", false},
+		{"matches pattern", "pattern: '^[A-Z]{2}$'", "AT", false},
+		{"doesn't match pattern", "pattern: '^[A-Z]{2}$'", "AUT", true},
+		{"pattern after conversion", "type: uint32\npattern: '^1'", "0100", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := NewFieldMapper(testFieldConfig(t, test.field))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := m.Map(test.input)
+			var constraintErr *ConstraintError
+			if violated := errors.As(err, &constraintErr); violated != test.violated {
+				t.Fatalf("got %v, error %v, want violation: %v", v, err, test.violated)
+			}
+			if !test.violated && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -2,16 +2,17 @@
 package convert
 
 import (
+	"context"
 	"encoding/binary"
-	"encoding/csv"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"path/filepath"
 	"runtime"
-	"strconv"
+	"sync"
+	"time"
 
 	"github.com/fholzer/csv2mmdb/pkg/convert/internal/valuecache"
 	"github.com/maxmind/mmdbwriter/mmdbtype"
@@ -31,33 +32,84 @@ func ConvertFile( //nolint: revive // stutters, should fix
 	inputFile string,
 	outputFile string,
 ) error {
+	_, err := ConvertFileWithStats(config, inputFile, outputFile)
+	return err
+}
+
+// ConvertFileWithReport is like ConvertFile, but returns the report of the
+// values that couldn't be translated or converted without aborting the
+// conversion.
+func ConvertFileWithReport(
+	config *Config,
+	inputFile string,
+	outputFile string,
+) (*MissReport, error) {
+	stats, err := ConvertFileWithStats(config, inputFile, outputFile)
+	if stats == nil {
+		return nil, err
+	}
+	return stats.Misses, err
+}
+
+// ConvertFileWithStats is like ConvertFile, but returns the conversion's
+// stats, whose Misses report the values that couldn't be translated or
+// converted without aborting the conversion.
+func ConvertFileWithStats(
+	config *Config,
+	inputFile string,
+	outputFile string,
+) (*ConversionStats, error) {
+	return ConvertFileWithOptions(config, inputFile, outputFile, nil)
+}
+
+// ConvertFileWithOptions is like ConvertFileWithStats, but takes options
+// controlling diagnostic output. If `opts` is nil, the defaults are used.
+func ConvertFileWithOptions(
+	config *Config,
+	inputFile string,
+	outputFile string,
+	opts *ConverterOptions,
+) (*ConversionStats, error) {
+	return ConvertFileContext(context.Background(), config, inputFile, outputFile, opts)
+}
+
+// ConvertFileContext is like ConvertFileWithOptions, but aborts the
+// conversion once `ctx` is done. In that case, the error returned wraps
+// ctx.Err(), and the output file is incomplete.
+func ConvertFileContext(
+	ctx context.Context,
+	config *Config,
+	inputFile string,
+	outputFile string,
+	opts *ConverterOptions,
+) (*ConversionStats, error) {
 	outFile, err := os.Create(filepath.Clean(outputFile))
 	if err != nil {
-		return errors.Wrapf(err, "error creating output file (%s)", outputFile)
+		return nil, errors.Wrapf(err, "error creating output file (%s)", outputFile)
 	}
 	defer outFile.Close() //nolint: gosec
 
 	inFile, err := os.Open(inputFile) //nolint: gosec
 	if err != nil {
-		return errors.Wrapf(err, "error opening input file (%s)", inputFile)
+		return nil, errors.Wrapf(err, "error opening input file (%s)", inputFile)
 	}
 	defer inFile.Close() //nolint: gosec
 
 	inFileInfo, err := inFile.Stat()
 	if err != nil {
-		return errors.Wrapf(err, "error retrieving input file stats (%s)", inputFile)
+		return nil, errors.Wrapf(err, "error retrieving input file stats (%s)", inputFile)
 	}
 
-	converter := NewConverter(config, inFile, inFileInfo.Size())
-	err = converter.Convert(outFile)
+	converter := NewConverterWithOptions(config, inFile, inFileInfo.Size(), opts)
+	stats, err := converter.ConvertContext(ctx, outFile)
 	if err != nil {
-		return err
+		return stats, err
 	}
 	err = outFile.Sync()
 	if err != nil {
-		return errors.Wrapf(err, "error syncing file (%s)", outputFile)
+		return stats, errors.Wrapf(err, "error syncing file (%s)", outputFile)
 	}
-	return nil
+	return stats, nil
 }
 
 const (
@@ -65,106 +117,271 @@ const (
 	STR_END_IP   string = "end_ip_int"
 )
 
+// ConverterOptions control the diagnostic output of a Converter.
+type ConverterOptions struct {
+	// Logger receives the diagnostic messages. Defaults to slog.Default().
+	Logger *slog.Logger
+	// ShowProgress enables a progress bar, which is written to stderr. It is
+	// only shown for input read from an io.Reader.
+	ShowProgress bool
+}
+
 type Converter struct {
-	config    *Config
-	rowMapper *RowMapper
-	mapCache  *valuecache.DataMap
-	input     io.Reader
-	inputSize int64
+	config       *Config
+	mapCache     *valuecache.DataMap
+	input        io.Reader
+	inputSize    int64
+	source       RowSource
+	logger       *slog.Logger
+	showProgress bool
 }
 
 func NewConverter(config *Config, input io.Reader, inputSize int64) *Converter {
+	return NewConverterWithOptions(config, input, inputSize, nil)
+}
+
+// NewConverterWithOptions is like NewConverter, but takes options
+// controlling diagnostic output. If `opts` is nil, the defaults are used.
+func NewConverterWithOptions(config *Config, input io.Reader, inputSize int64, opts *ConverterOptions) *Converter {
+	if opts == nil {
+		opts = &ConverterOptions{}
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
 	return &Converter{
-		config:    config,
-		input:     input,
-		inputSize: inputSize,
-		mapCache:  valuecache.NewDataMap(),
+		config:       config,
+		input:        input,
+		inputSize:    inputSize,
+		mapCache:     valuecache.NewDataMap(),
+		logger:       logger,
+		showProgress: opts.ShowProgress,
 	}
 }
 
-// Convert writes the MaxMind GeoIP2 or GeoLite2 CSV in the `input` io.Reader
-// to the Writer `output`.
+// NewSourceConverter creates a Converter reading the rows of `source`,
+// instead of an io.Reader. The config's InputFormat doesn't apply. If `opts`
+// is nil, the defaults are used.
+func NewSourceConverter(config *Config, source RowSource, opts *ConverterOptions) *Converter {
+	c := NewConverterWithOptions(config, nil, 0, opts)
+	c.source = source
+	return c
+}
+
+// Convert writes the MaxMind GeoIP2 or GeoLite2 CSV, or JSON Lines if
+// configured, in the `input` io.Reader, or the rows of the Converter's
+// RowSource, to the Writer `output`.
 func (c *Converter) Convert(
 	output io.Writer,
 ) error {
-	tree, err := mmdbwriter.New(mmdbwriter.Options{
-		DatabaseType:            c.config.DatabaseType,
-		IncludeReservedNetworks: true,
-		IPVersion:               4,
-		DisableMetadataPointers: true,
-	})
+	_, err := c.ConvertContext(context.Background(), output)
+	return err
+}
+
+// ConvertWithReport is like Convert, but returns the report of the values
+// that couldn't be translated or converted without aborting the conversion.
+func (c *Converter) ConvertWithReport(
+	output io.Writer,
+) (*MissReport, error) {
+	stats, err := c.ConvertWithStats(output)
+	return stats.Misses, err
+}
+
+// ConvertWithStats is like Convert, but returns the conversion's stats,
+// whose Misses report the values that couldn't be translated or converted
+// without aborting the conversion.
+func (c *Converter) ConvertWithStats(
+	output io.Writer,
+) (*ConversionStats, error) {
+	return c.ConvertContext(context.Background(), output)
+}
+
+// ConvertContext is like ConvertWithStats, but aborts the conversion once
+// `ctx` is done, which is checked between rows, and while writing the
+// database. In that case, the error returned wraps ctx.Err(). The stats
+// returned are never nil, and cover the part of the conversion completed if
+// an error is returned.
+func (c *Converter) ConvertContext(
+	ctx context.Context,
+	output io.Writer,
+) (*ConversionStats, error) {
+	stats := newConversionStats()
+	sampler := startHeapSampler()
+	defer func() { stats.PeakHeapBytes = sampler.Stop() }()
+
+	source := c.source
+	var bar *progressbar.ProgressBar
+	if source == nil {
+		input := c.input
+		if c.showProgress {
+			bar = progressbar.DefaultBytes(c.inputSize)
+			defer bar.Close()
+			pbReader := progressbar.NewReader(c.input, bar)
+			input = &pbReader
+		}
+		source = newInputSource(c.config.InputFormat, input)
+	}
+
+	phaseStart := time.Now()
+	columns, err := source.Columns()
 	if err != nil {
-		return errors.Wrap(err, "error creating new mmdb tree")
+		return stats, err
 	}
 
-	bar := progressbar.DefaultBytes(c.inputSize)
-	defer bar.Close()
-	bar.Clear()
-	pbReader := progressbar.NewReader(c.input, bar)
-	reader := csv.NewReader(&pbReader)
+	workers := c.config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	var interner *valuecache.Interner
+	if c.config.UseValueCache || c.config.BoundedMemory {
+		interner = valuecache.NewInterner()
+	}
+	rowMappers := make([]*RowMapper, workers)
+	for i := range rowMappers {
+		rowMappers[i], err = NewSourceMapper(c.config, columns, stats.Misses)
+		if err != nil {
+			return stats, errors.Wrap(err, "error creating row mapper")
+		}
+		rowMappers[i].interner = interner
+	}
+	c.logger.Debug("mapping rows", slog.Int("workers", workers), slog.Bool("boundedMemory", c.config.BoundedMemory), slog.Bool("valueCache", c.config.UseValueCache))
 
-	header, err := reader.Read()
-	if err != nil {
-		return errors.Wrap(err, "error reading CSV header")
+	// in bounded-memory mode, the database is only written once all rows
+	// have been read, see rangeSorter and treeWriter
+	var tree *mmdbwriter.Tree
+	var sorter *rangeSorter
+	var insert func(r *mappedRecord) error
+	if c.config.BoundedMemory {
+		sorter = newRangeSorter(c.config.TempDir)
+		defer sorter.Close()
+		insert = func(r *mappedRecord) error { return sorter.Add(r.start, r.end, r.data) }
+	} else {
+		tree, err = mmdbwriter.New(mmdbwriter.Options{
+			DatabaseType:            c.config.DatabaseType,
+			Languages:               c.config.Languages,
+			IncludeReservedNetworks: true,
+			IPVersion:               4,
+			DisableMetadataPointers: true,
+		})
+		if err != nil {
+			return stats, errors.Wrap(err, "error creating new mmdb tree")
+		}
+		insert = func(r *mappedRecord) error { return c.insert(tree, stats, r) }
 	}
 
-	rowMapper, err := NewMapper(c.config, header)
-	if err != nil {
-		return errors.Wrap(err, "error creating row mapper")
-	}
-	c.rowMapper = rowMapper
-	bar.Clear()
-
-	// This holds the previously read, but not yet written row. We hold it instead of writing it immediately,
-	// because we might be able to merge it with subsequent rows, if all the selected/filtered-for fields are
-	// equal.
-	// var lastReadRecord []string
-	var row int = 0
-	for {
-		data, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return errors.Wrap(err, "error reading CSV")
+	// Rows are read by a single goroutine, mapped by `workers` goroutines, and
+	// inserted into the tree by this goroutine, in input order.
+	pipelineCtx, cancelPipeline := context.WithCancel(ctx)
+	defer cancelPipeline()
+	batches := make(chan *rowBatch, workers)
+	results := make(chan *recordBatch, workers)
+	slots := make(chan struct{}, maxBatchesPerWorker*workers)
+	var wg sync.WaitGroup
+	wg.Add(1 + workers)
+	go func() {
+		defer wg.Done()
+		readRows(pipelineCtx, source, batches, slots)
+	}()
+	for _, rowMapper := range rowMappers {
+		go func(rowMapper *RowMapper) {
+			defer wg.Done()
+			mapRows(pipelineCtx, rowMapper, batches, results)
+		}(rowMapper)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// stop terminates the pipeline early and waits for its goroutines to
+	// finish
+	stop := func() {
+		cancelPipeline()
+		for range results {
 		}
-		row++
-
-		// if lastReadRecord != nil {
-		// 	// compare this to previous row
-		// 	shouldMerge := rowMapper.CanMergeRows(lastReadRecord, data)
-
-		// 	if shouldMerge {
-		// 		// set previous row's end_ip to current row's end_ip
-		// 		lastReadRecord[1] = strings.Clone(data[1])
-		// 		continue
-		// 	}
-
-		// 	if err := c.insert(tree, lastReadRecord); err != nil {
-		// 		return errors.Wrapf(err, "error writing output record (at input row %d)", row)
-		// 	}
-		// }
-		if err := c.insert(tree, data); err != nil {
-			return errors.Wrapf(err, "error writing output record (at input row %d)", row)
+	}
+
+	pending := map[int]*recordBatch{}
+	next := 0
+	for res := range results {
+		pending[res.seq] = res
+		for b, ok := pending[next]; ok; b, ok = pending[next] {
+			delete(pending, next)
+			next++
+			<-slots
+			stats.RowsRead += uint64(b.rows)
+			for reason, n := range b.skipped {
+				stats.RowsSkipped[reason] += n
+			}
+			for _, r := range b.records {
+				if err := insert(r); err != nil {
+					stop()
+					return stats, err
+				}
+				stats.RowsInserted++
+			}
+			if b.err != nil {
+				stop()
+				return stats, b.err
+			}
 		}
-		// lastReadRecord = data
 	}
+	// the pipeline stops early if the context is done
+	if err := ctx.Err(); err != nil {
+		return stats, errors.Wrap(err, "conversion cancelled")
+	}
+	stats.addPhase(PhaseMap, phaseStart)
+	if bar != nil {
+		bar.Finish()
+	}
+	c.logger.Info("mapped rows", slog.Uint64("read", stats.RowsRead), slog.Uint64("inserted", stats.RowsInserted))
 
-	// if lastReadRecord != nil {
-	// 	if err := c.insert(tree, lastReadRecord); err != nil {
-	// 		return errors.Wrapf(err, "error writing output record (at input row %d)", row)
-	// 	}
-	// }
+	var db io.WriterTo = tree
+	if sorter != nil {
+		c.logger.Info("merging sorted ranges")
+		phaseStart = time.Now()
+		treeWriter, err := newTreeWriter(c.config, sorter.records, c.config.TempDir)
+		if err != nil {
+			return stats, err
+		}
+		defer treeWriter.Close()
+		err = sorter.Merge(func(start uint32, end uint32, id uint32) error {
+			if err := ctx.Err(); err != nil {
+				return errors.Wrap(err, "conversion cancelled")
+			}
+			return treeWriter.Insert(start, end, id)
+		})
+		stats.RowsMerged = sorter.merged
+		stats.UniqueRecords = uint64(sorter.records.Len())
+		if err != nil {
+			return stats, errors.Wrap(err, "error merging sorted ranges")
+		}
+		stats.addPhase(PhaseMerge, phaseStart)
+		db = treeWriter
+	}
 
-	PrintMemUsage()
-	log.Println("Writing mmdb tree data...")
-	_, err = tree.WriteTo(output)
-	if err == nil {
-		log.Println("done writing")
+	phaseStart = time.Now()
+	c.logger.Info("writing mmdb tree data")
+	counter := &outputCounter{ctx: ctx, w: output}
+	_, err = db.WriteTo(counter)
+	stats.OutputBytes = counter.n
+	if err != nil {
+		return stats, errors.Wrap(err, "error writing CSV")
 	}
+	c.logger.Info("done writing", slog.Int64("bytes", stats.OutputBytes))
+	if n, ok := counter.NodeCount(); ok {
+		stats.NodeCount = n
+	}
+	stats.addPhase(PhaseWrite, phaseStart)
 
-	return errors.Wrap(err, "error writing CSV")
+	return stats, nil
 }
 
+// PrintMemUsage prints the current memory usage to stdout.
+//
+// Deprecated: Use the PeakHeapBytes of the ConversionStats returned by
+// ConvertWithStats instead.
 func PrintMemUsage() {
 	runtime.GC()
 	var m runtime.MemStats
@@ -180,37 +397,22 @@ func bToMb(b uint64) uint64 {
 	return b / 1024 / 1024
 }
 
-func (c *Converter) insert(tree *mmdbwriter.Tree, data []string) error {
-	iStart, err := strconv.ParseUint(data[0], 10, 32)
-	if err != nil {
-		return errors.Wrapf(err, "Error converting start IP to int: %s\n", data[0])
-	}
-
-	iEnd, err := strconv.ParseUint(data[1], 10, 32)
-	if err != nil {
-		return errors.Wrapf(err, "Error converting end IP to int: %s\n", data[1])
-	}
-
-	r, err := c.rowMapper.Map(data)
-	if err != nil {
-		return err
-	}
-	if r == nil {
-		return nil
-	}
-
+func (c *Converter) insert(tree *mmdbwriter.Tree, stats *ConversionStats, r *mappedRecord) error {
+	data := r.data
 	if c.config.UseValueCache {
-		cv, err := c.mapCache.Store(r)
+		cv, err := c.mapCache.Store(data)
 		if err != nil {
 			return errors.Wrapf(err, "Error accessing value cache")
 		}
-		r = cv.Data.(mmdbtype.Map)
+		if cv.RefCount() == 1 {
+			stats.UniqueRecords++
+		}
+		data = cv.Data.(mmdbtype.Map)
 	}
 
-	start := int2ip(uint32(iStart))
-	end := int2ip(uint32(iEnd))
-
-	tree.InsertRange(start, end, r)
+	if err := tree.InsertRange(r.start, r.end, data); err != nil {
+		return errors.Wrapf(err, "Error inserting range %s-%s", r.start, r.end)
+	}
 	return nil
 }
 
@@ -0,0 +1,187 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+const testConfig = `
+databaseType: Test
+fields:
+  - name: country
+    target: country.iso_code
+    capitalization: upper
+    critical: true
+  - name: lat
+    target: location.latitude
+    type: float64
+    precision: 1
+  - name: asn
+    target: asn
+    type: uint32
+    ignoreEmpty: true
+  - name: flag
+    target: flag
+    type: boolean
+    omitZeroValue: true
+`
+
+// testInput returns CSV input with `rows` rows of adjacent ranges, in random
+// order. Consecutive ranges often have equal records, and some rows are
+// omitted as their country is empty. If `overlapping` is true, every 100th
+// range is extended, so it overlaps the following ranges.
+func testInput(rows int, overlapping bool) string {
+	rnd := rand.New(rand.NewSource(1))
+	lines := make([]string, rows)
+	start := uint32(1 << 24)
+	for i := range lines {
+		end := start + uint32(rnd.Intn(1000))
+		country := []string{"at", "de", "ch", ""}[rnd.Intn(4)]
+		asn := ""
+		if rnd.Intn(2) == 0 {
+			asn = fmt.Sprint(rnd.Intn(100))
+		}
+		next := end + 1
+		if overlapping && i%100 == 0 {
+			end += uint32(rnd.Intn(100000))
+		}
+		lines[i] = fmt.Sprintf("%d,%d,%s,%.2f,%s,%d", start, end, country, float64(rnd.Intn(100))/10, asn, rnd.Intn(2))
+		start = next
+	}
+	rnd.Shuffle(len(lines), func(i, j int) { lines[i], lines[j] = lines[j], lines[i] })
+	return "start_ip_int,end_ip_int,country,lat,asn,flag\n" + strings.Join(lines, "\n") + "\n"
+}
+
+// testConvert converts `input` using the test configuration, modified by
+// `configure`, and returns the database along with the conversion stats.
+func testConvert(t *testing.T, input string, configure func(*Config)) ([]byte, *ConversionStats) {
+	t.Helper()
+	config, err := testNewConfig(t, testConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.TempDir = t.TempDir()
+	configure(config)
+
+	var output bytes.Buffer
+	c := NewConverterWithOptions(config, strings.NewReader(input), int64(len(input)), &ConverterOptions{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	stats, err := c.ConvertWithStats(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output.Bytes(), stats
+}
+
+// decodedRange is an IP range of a database, along with its decoded record.
+type decodedRange struct {
+	start  uint32
+	end    uint32
+	record interface{}
+}
+
+// decodeRanges decodes all networks of the database `db`, and joins
+// adjacent networks with equal records. The result is independent of how
+// ranges were split into networks.
+func decodeRanges(t *testing.T, db []byte) []decodedRange {
+	t.Helper()
+	reader, err := maxminddb.FromBytes(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// descriptions aren't supported, but are required by Verify
+	reader.Metadata.Description = map[string]string{"en": "test"}
+	if err := reader.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ranges []decodedRange
+	networks := reader.Networks()
+	for networks.Next() {
+		var record interface{}
+		network, err := networks.Network(&record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := binary.BigEndian.Uint32(network.IP.To4())
+		end := start | ^binary.BigEndian.Uint32(network.Mask)
+		ranges = append(ranges, decodedRange{start: start, end: end, record: record})
+	}
+	if err := networks.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	var joined []decodedRange
+	for _, r := range ranges {
+		if n := len(joined); n > 0 && joined[n-1].end+1 == r.start && reflect.DeepEqual(joined[n-1].record, r.record) {
+			joined[n-1].end = r.end
+			continue
+		}
+		joined = append(joined, r)
+	}
+	return joined
+}
+
+func compareRanges(t *testing.T, got []decodedRange, want []decodedRange) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d ranges, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("range %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestConvertWorkers(t *testing.T) {
+	input := testInput(20*batchSize, true)
+	db, stats := testConvert(t, input, func(c *Config) { c.Workers = 1 })
+	want := decodeRanges(t, db)
+	if len(want) == 0 {
+		t.Fatal("database is empty")
+	}
+
+	for _, workers := range []int{2, 8} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			db, s := testConvert(t, input, func(c *Config) { c.Workers = workers })
+			compareRanges(t, decodeRanges(t, db), want)
+			if s.RowsInserted != stats.RowsInserted || s.RowsRead != stats.RowsRead {
+				t.Fatalf("inserted %d of %d rows, want %d of %d", s.RowsInserted, s.RowsRead, stats.RowsInserted, stats.RowsRead)
+			}
+		})
+	}
+}
+
+func TestConvertBoundedMemory(t *testing.T) {
+	for _, overlapping := range []bool{false, true} {
+		t.Run(fmt.Sprintf("overlapping=%v", overlapping), func(t *testing.T) {
+			input := testInput(20*batchSize, overlapping)
+			db, normalStats := testConvert(t, input, func(c *Config) {})
+			want := decodeRanges(t, db)
+
+			db, stats := testConvert(t, input, func(c *Config) { c.BoundedMemory = true })
+			compareRanges(t, decodeRanges(t, db), want)
+			if stats.RowsMerged == 0 {
+				t.Fatal("no ranges were merged")
+			}
+			// the tree is minimal, while mmdbwriter doesn't always merge
+			// networks with the same record
+			if stats.NodeCount == 0 || stats.NodeCount > normalStats.NodeCount {
+				t.Fatalf("got %d nodes, want at most %d", stats.NodeCount, normalStats.NodeCount)
+			}
+		})
+	}
+}
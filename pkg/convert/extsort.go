@@ -0,0 +1,311 @@
+package convert
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"sort"
+
+	"github.com/fholzer/csv2mmdb/pkg/convert/internal/valuecache"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/pkg/errors"
+)
+
+// sortBufferSize is the number of ranges held in memory by a rangeSorter,
+// before they're spilled to disk.
+const sortBufferSize = 1 << 20
+
+// rangeEntrySize is the size of a rangeEntry on disk.
+const rangeEntrySize = 20
+
+// rangeEntry is an IP range, along with the ID of its record, and the
+// sequence number telling the order in which ranges were added.
+type rangeEntry struct {
+	start uint32
+	end   uint32
+	id    uint32
+	seq   uint64
+}
+
+// before reports whether `e` is sorted before `o`, i.e. by start address,
+// and ranges with the same start address in the order they were added.
+func (e *rangeEntry) before(o *rangeEntry) bool {
+	if e.start != o.start {
+		return e.start < o.start
+	}
+	return e.seq < o.seq
+}
+
+// rangeSorter implements the bounded-memory mode. Records are deduplicated
+// to IDs as they are added, and ranges are sorted externally, spilling
+// sorted runs to temporary files. Once all ranges were added, the runs are
+// merged into non-overlapping ranges, joining adjacent ranges with the same
+// record, which are passed on in ascending order, see treeWriter.
+type rangeSorter struct {
+	tempDir string
+	records *valuecache.RecordStore
+	// bufferSize is the number of ranges buffered before they're spilled
+	bufferSize int
+	buf        []rangeEntry
+	runs       []*os.File
+	// seq is the sequence number of the next range added
+	seq uint64
+	// merged is the number of ranges joined with the preceding range
+	merged uint64
+}
+
+func newRangeSorter(tempDir string) *rangeSorter {
+	return &rangeSorter{
+		tempDir:    tempDir,
+		records:    valuecache.NewRecordStore(),
+		bufferSize: sortBufferSize,
+	}
+}
+
+// Add adds the record `data` for the range from `start` to `end`.
+func (s *rangeSorter) Add(start net.IP, end net.IP, data mmdbtype.DataType) error {
+	id, err := s.records.Store(data)
+	if err != nil {
+		return errors.Wrapf(err, "Error accessing value cache")
+	}
+	s.buf = append(s.buf, rangeEntry{
+		start: binary.BigEndian.Uint32(start.To4()),
+		end:   binary.BigEndian.Uint32(end.To4()),
+		id:    id,
+		seq:   s.seq,
+	})
+	s.seq++
+	if len(s.buf) >= s.bufferSize {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill writes the buffered ranges, sorted by rangeEntry.before, to a new
+// temporary file.
+func (s *rangeSorter) spill() error {
+	sort.Slice(s.buf, func(i, j int) bool { return s.buf[i].before(&s.buf[j]) })
+
+	file, err := os.CreateTemp(s.tempDir, "csv2mmdb-*.run")
+	if err != nil {
+		return errors.Wrap(err, "error creating temporary file")
+	}
+	s.runs = append(s.runs, file)
+
+	w := bufio.NewWriter(file)
+	var b [rangeEntrySize]byte
+	for _, e := range s.buf {
+		binary.BigEndian.PutUint32(b[0:], e.start)
+		binary.BigEndian.PutUint32(b[4:], e.end)
+		binary.BigEndian.PutUint32(b[8:], e.id)
+		binary.BigEndian.PutUint64(b[12:], e.seq)
+		if _, err := w.Write(b[:]); err != nil {
+			return errors.Wrapf(err, "error writing temporary file (%s)", file.Name())
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrapf(err, "error writing temporary file (%s)", file.Name())
+	}
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// Merge merges the sorted runs, and passes the resulting ranges to `emit`,
+// in ascending order. Where ranges overlap, the range added last takes
+// precedence, just like when inserting the ranges into a tree in order.
+// Adjacent ranges with the same record are joined.
+func (s *rangeSorter) Merge(emit func(start uint32, end uint32, id uint32) error) error {
+	if len(s.buf) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+
+	h := &runHeap{}
+	for _, file := range s.runs {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrapf(err, "error reading temporary file (%s)", file.Name())
+		}
+		r := &runReader{file: file, reader: bufio.NewReader(file)}
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			*h = append(*h, r)
+		}
+	}
+	heap.Init(h)
+
+	// join joins adjacent ranges with the same record
+	var cur rangeEntry
+	haveCur := false
+	join := func(start uint32, end uint32, id uint32) error {
+		if haveCur && cur.id == id && cur.end+1 == start {
+			cur.end = end
+			s.merged++
+			return nil
+		}
+		if haveCur {
+			if err := emit(cur.start, cur.end, cur.id); err != nil {
+				return err
+			}
+		}
+		cur = rangeEntry{start: start, end: end, id: id}
+		haveCur = true
+		return nil
+	}
+
+	p := &rangePainter{emit: join}
+	for h.Len() > 0 {
+		r := (*h)[0]
+		if err := p.add(r.cur); err != nil {
+			return err
+		}
+
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	if err := p.paintUntil(1 << 32); err != nil {
+		return err
+	}
+	if haveCur {
+		return emit(cur.start, cur.end, cur.id)
+	}
+	return nil
+}
+
+// Close removes the temporary files.
+func (s *rangeSorter) Close() {
+	for _, file := range s.runs {
+		file.Close()           //nolint: gosec
+		os.Remove(file.Name()) //nolint: gosec
+	}
+	s.runs = nil
+}
+
+// rangePainter resolves overlapping ranges, which are added sorted by
+// rangeEntry.before. Each address is assigned the record of the range added
+// last among the ranges containing it. Only ranges which may still contain
+// addresses to be painted are kept, so memory usage depends on the number of
+// overlapping ranges, rather than the total number of ranges.
+type rangePainter struct {
+	emit func(start uint32, end uint32, id uint32) error
+	// pos is the first address not painted yet
+	pos uint64
+	// active holds the ranges containing `pos`, as well as ranges which
+	// have ended but weren't removed yet
+	active activeHeap
+	// compactAt is the size of `active` at which ended ranges are removed
+	compactAt int
+}
+
+func (p *rangePainter) add(e rangeEntry) error {
+	if err := p.paintUntil(uint64(e.start)); err != nil {
+		return err
+	}
+	// ranges entirely covered by a range added later are never painted
+	if len(p.active) > 0 && p.active[0].seq > e.seq && p.active[0].end >= e.end {
+		return nil
+	}
+	heap.Push(&p.active, e)
+
+	if len(p.active) >= p.compactAt {
+		kept := p.active[:0]
+		for _, a := range p.active {
+			if uint64(a.end) >= p.pos {
+				kept = append(kept, a)
+			}
+		}
+		p.active = kept
+		heap.Init(&p.active)
+		p.compactAt = 2*len(p.active) + 1024
+	}
+	return nil
+}
+
+// paintUntil paints the addresses from `pos` up to, but excluding, `until`,
+// using the active ranges.
+func (p *rangePainter) paintUntil(until uint64) error {
+	for p.pos < until {
+		for len(p.active) > 0 && uint64(p.active[0].end) < p.pos {
+			heap.Pop(&p.active)
+		}
+		if len(p.active) == 0 {
+			p.pos = until
+			return nil
+		}
+
+		top := &p.active[0]
+		end := uint64(top.end) + 1
+		if end > until {
+			end = until
+		}
+		if err := p.emit(uint32(p.pos), uint32(end-1), top.id); err != nil {
+			return err
+		}
+		p.pos = end
+	}
+	return nil
+}
+
+// runReader reads the ranges of a sorted run.
+type runReader struct {
+	file   *os.File
+	reader *bufio.Reader
+	cur    rangeEntry
+}
+
+func (r *runReader) next() (bool, error) {
+	var b [rangeEntrySize]byte
+	if _, err := io.ReadFull(r.reader, b[:]); err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "error reading temporary file (%s)", r.file.Name())
+	}
+	r.cur = rangeEntry{
+		start: binary.BigEndian.Uint32(b[0:]),
+		end:   binary.BigEndian.Uint32(b[4:]),
+		id:    binary.BigEndian.Uint32(b[8:]),
+		seq:   binary.BigEndian.Uint64(b[12:]),
+	}
+	return true, nil
+}
+
+// runHeap orders runReaders by their current range, see rangeEntry.before.
+type runHeap []*runReader
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].cur.before(&h[j].cur) }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// activeHeap orders ranges by sequence number, the range added last first.
+type activeHeap []rangeEntry
+
+func (h activeHeap) Len() int            { return len(h) }
+func (h activeHeap) Less(i, j int) bool  { return h[i].seq > h[j].seq }
+func (h activeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *activeHeap) Push(x interface{}) { *h = append(*h, x.(rangeEntry)) }
+func (h *activeHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,87 @@
+package convert
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+func TestRangeSorterMerge(t *testing.T) {
+	const addresses = 2000
+	rnd := rand.New(rand.NewSource(1))
+
+	dir := t.TempDir()
+	s := newRangeSorter(dir)
+	s.bufferSize = 64
+	defer s.Close()
+
+	// want holds the value of each address, as painted by ranges in the
+	// order they are added, or -1 if the address is empty
+	want := make([]int, addresses)
+	for i := range want {
+		want[i] = -1
+	}
+	for i := 0; i < 1000; i++ {
+		start := rnd.Intn(addresses)
+		end := start + rnd.Intn(10)
+		if i%50 == 0 {
+			// a large range, overlapping many others
+			end = start + rnd.Intn(200)
+		}
+		if end >= addresses {
+			end = addresses - 1
+		}
+		n := rnd.Intn(3)
+		for a := start; a <= end; a++ {
+			want[a] = n
+		}
+		if err := s.Add(int2ip(uint32(start)), int2ip(uint32(end)), mmdbtype.Map{"n": mmdbtype.Uint32(n)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.runs) < 2 {
+		t.Fatalf("got %d runs, want ranges to be spilled to multiple runs", len(s.runs))
+	}
+
+	got := make([]int, addresses)
+	for i := range got {
+		got[i] = -1
+	}
+	var last rangeEntry
+	haveLast := false
+	err := s.Merge(func(start uint32, end uint32, id uint32) error {
+		if haveLast && start <= last.end {
+			t.Fatalf("range %d-%d follows range %d-%d", start, end, last.start, last.end)
+		}
+		if haveLast && start == last.end+1 && id == last.id {
+			t.Fatalf("adjacent ranges %d-%d and %d-%d with the same record weren't joined", last.start, last.end, start, end)
+		}
+		last = rangeEntry{start: start, end: end, id: id}
+		haveLast = true
+
+		n := int(s.records.Get(id).(mmdbtype.Map)["n"].(mmdbtype.Uint32))
+		for a := start; a <= end; a++ {
+			got[a] = n
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for a := range want {
+		if got[a] != want[a] {
+			t.Fatalf("address %d: got %d, want %d", a, got[a], want[a])
+		}
+	}
+	if s.merged == 0 {
+		t.Fatal("no ranges were joined")
+	}
+
+	s.Close()
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) > 0 {
+		t.Fatalf("temporary files weren't removed: %v %v", entries, err)
+	}
+}
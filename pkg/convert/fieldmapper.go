@@ -1,36 +1,62 @@
 package convert
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/maxmind/mmdbwriter/mmdbtype"
 	"github.com/pkg/errors"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
 )
 
+// ErrOmitRecord may be returned by a FieldMapper's Map function, indicating
+// that the whole record shall be omitted.
+var ErrOmitRecord = errors.New("omit record")
+
+// ErrOmitValue may be returned by a FieldMapper's Map function, indicating
+// that the field shall be omitted from the record.
+var ErrOmitValue = errors.New("omit value")
+
 type FieldMapper interface {
 	Map(string) (mmdbtype.DataType, error)
 	ShouldOmitRecord(string) bool
 	ShouldOmitValue(string) bool
 	GetConfig() *FieldConfig
 	GetTargetFieldComponents() []string
+	SetMissReporter(MissReporter)
+}
+
+type replacer struct {
+	pattern     *regexp.Regexp
+	replacement string
 }
 
 type BaseFieldMapper struct {
 	targetFieldComponents []string
-	caser                 *cases.Caser
+	caser                 capitalizer
+	missReporter          MissReporter
+	normalizer            *norm.Form
+	extract               *regexp.Regexp
+	replacers             []replacer
+	// validators are run on parsed values, in order
+	validators []func(mmdbtype.DataType) error
 	FieldConfig
 }
 
 func (m *BaseFieldMapper) ShouldOmitRecord(input string) bool {
-	return m.Critical && input == ""
+	return m.Critical && m.trim(input) == ""
 }
 
 func (m *BaseFieldMapper) ShouldOmitValue(input string) bool {
-	return m.IgnoreEmpty && input == ""
+	return m.IgnoreEmpty && m.trim(input) == ""
 }
 
 func (m *BaseFieldMapper) GetConfig() *FieldConfig {
@@ -41,119 +67,272 @@ func (m *BaseFieldMapper) GetTargetFieldComponents() []string {
 	return m.targetFieldComponents
 }
 
-var titleCaser cases.Caser = cases.Title(language.English)
-var upperCaser cases.Caser = cases.Upper(language.English)
-var lowerCaser cases.Caser = cases.Lower(language.English)
+func (m *BaseFieldMapper) SetMissReporter(r MissReporter) {
+	m.missReporter = r
+}
+
+// ReportMiss passes a value that couldn't be translated or converted on to
+// the MissReporter, if one is set.
+func (m *BaseFieldMapper) ReportMiss(kind string, value string) {
+	if m.missReporter != nil {
+		m.missReporter.ReportMiss(&m.FieldConfig, kind, value)
+	}
+}
+
+// Process runs the source value through all stages of the mapping pipeline:
+// Preprocess, parse, zero-value check and validation. Every FieldMapper
+// implementation's Map function should delegate to Process, passing the
+// function that parses the preprocessed value into the field's type.
+func (m *BaseFieldMapper) Process(input string, parse func(string) (mmdbtype.DataType, error)) (mmdbtype.DataType, error) {
+	s, err := m.Preprocess(input)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.OmitZeroValue && isZeroValue(v) {
+		return nil, nil
+	}
+
+	for _, validate := range m.validators {
+		if err := validate(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// Preprocess trims the source value, normalizes, transliterates and
+// collapses its white space, extracts the relevant part, applies
+// replacements, translates and capitalizes it, in that order. The result is
+// then parsed according to the field's type by the respective FieldMapper.
+func (m *BaseFieldMapper) Preprocess(input string) (string, error) {
+	s := m.trim(input)
+
+	// normalize
+	if m.normalizer != nil {
+		s = m.normalizer.String(s)
+	}
+	if m.Transliterate {
+		s = transliterate(s)
+	}
+	if m.CollapseWhitespace {
+		s = strings.Join(strings.Fields(s), " ")
+	}
+
+	// extract
+	if m.extract != nil {
+		match := m.extract.FindStringSubmatch(s)
+		if match == nil {
+			return "", fmt.Errorf("value '%s' of field '%s' doesn't match extract pattern '%s'", input, m.Name, m.Extract)
+		}
+		if len(match) > 1 {
+			s = match[1]
+		} else {
+			s = match[0]
+		}
+	}
+
+	// replace
+	for _, r := range m.replacers {
+		s = r.pattern.ReplaceAllString(s, r.replacement)
+	}
+
+	// translate
+	if m.Translate != nil {
+		var err error
+		if s, err = m.translate(s, input); err != nil {
+			return "", err
+		}
+	}
 
-func (m *BaseFieldMapper) Preprocess(s string) string {
 	// capitalize
 	if m.caser != nil {
 		s = m.caser.String(s)
 	}
 
-	// translate
-	// if m.Translate != nil {
-	// 	if v, ok := m.Translate[s]; ok {
-	// 		s = v
-	// 	} else {
-	// 		fmt.Printf("No translation for '%s' value '%s' with target field '%s'\n", m.Name, s, m.Target)
-	// 	}
-	// }
-
-	// create mmdbtype maker
+	return s, nil
+}
+
+func (m *BaseFieldMapper) trim(s string) string {
+	if m.Trim {
+		return strings.TrimSpace(s)
+	}
 	return s
 }
 
-func NewFieldMapper(f *FieldConfig) (FieldMapper, error) {
-	switch f.Type {
-	case "string":
-		return NewStringFieldMapper(f), nil
-	case "int32":
-		return NewInt32FieldMapper(f), nil
-	case "uint16":
-		return NewUint16FieldMapper(f), nil
-	case "uint32":
-		return NewUint32FieldMapper(f), nil
-	case "uint64":
-		return NewUint64FieldMapper(f), nil
-	case "boolean":
-		return NewBooleanFieldMapper(f), nil
-	case "float32":
-		return NewFloat32FieldMapper(f), nil
-	case "float64":
-		return NewFloat64FieldMapper(f), nil
-	default:
-		return nil, fmt.Errorf("unknown field type '%s' for field '%s'", f.Type, f.Name)
+func (m *BaseFieldMapper) translate(s string, input string) (string, error) {
+	if v, ok := m.Translate.Values[s]; ok {
+		return v, nil
 	}
+
+	if m.TranslateMode != TranslateModeError {
+		m.ReportMiss(MissKindTranslation, input)
+	}
+
+	switch m.TranslateMode {
+	case TranslateModeDefault:
+		return *m.TranslateDefault, nil
+	case TranslateModeOmitValue:
+		return "", ErrOmitValue
+	case TranslateModeOmitRecord:
+		return "", ErrOmitRecord
+	case TranslateModeError:
+		return "", fmt.Errorf("no translation for field '%s' value '%s' with target field '%s'", m.Name, input, m.Target)
+	}
+	return s, nil
+}
+
+// isZeroValue reports whether `v` is the zero value of its type.
+func isZeroValue(v mmdbtype.DataType) bool {
+	switch t := v.(type) {
+	case mmdbtype.String:
+		return t == ""
+	case mmdbtype.Bool:
+		return !bool(t)
+	case mmdbtype.Int32:
+		return t == 0
+	case mmdbtype.Uint16:
+		return t == 0
+	case mmdbtype.Uint32:
+		return t == 0
+	case mmdbtype.Uint64:
+		return t == 0
+	case *mmdbtype.Uint128:
+		return (*big.Int)(t).Sign() == 0
+	case mmdbtype.Float32:
+		return t == 0
+	case mmdbtype.Float64:
+		return t == 0
+	case mmdbtype.Bytes:
+		return len(t) == 0
+	case mmdbtype.Map:
+		return len(t) == 0
+	case mmdbtype.Slice:
+		return len(t) == 0
+	}
+	return false
 }
 
-func newBaseFieldMapper(fc *FieldConfig) *BaseFieldMapper {
+// NewBaseFieldMapper creates the BaseFieldMapper for a field configuration.
+// Custom FieldMapper implementations should embed it, in order to support
+// all the common field configuration properties.
+func NewBaseFieldMapper(fc *FieldConfig) (*BaseFieldMapper, error) {
 	targetFieldComponents := strings.Split(fc.Target, ".")
-	var caser *cases.Caser
-
-	switch fc.Capitalization {
-	case "":
-	case "lower":
-		caser = &lowerCaser
-	case "upper":
-		caser = &upperCaser
-	case "title":
-		caser = &titleCaser
-	default:
-		panic(fmt.Sprintf("unknown capitalization mode '%s' for fiel '%s'", fc.Capitalization, fc.Name))
+	caser, err := newCapitalizer(fc)
+	if err != nil {
+		return nil, err
+	}
+
+	var extract *regexp.Regexp
+	if fc.Extract != "" {
+		if extract, err = regexp.Compile(fc.Extract); err != nil {
+			return nil, errors.Wrapf(err, "invalid extract pattern for field '%s'", fc.Name)
+		}
+	}
+	var replacers []replacer
+	for _, r := range fc.Replace {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid replace pattern for field '%s'", fc.Name)
+		}
+		replacers = append(replacers, replacer{
+			pattern:     pattern,
+			replacement: r.Replacement,
+		})
+	}
+	var normalizer *norm.Form
+	if form, ok := normalizationForms[fc.Normalize]; ok {
+		normalizer = &form
+	}
+	validators, err := newValidators(fc)
+	if err != nil {
+		return nil, err
 	}
 
 	return &BaseFieldMapper{
 		targetFieldComponents: targetFieldComponents,
 		caser:                 caser,
+		normalizer:            normalizer,
+		extract:               extract,
+		replacers:             replacers,
+		validators:            validators,
 		FieldConfig:           *fc,
+	}, nil
+}
+
+// must returns the FieldMapper created by a constructor, or panics if the
+// constructor failed. It is used by the deprecated constructors, which don't
+// return errors.
+func must[T FieldMapper](m T, err error) T {
+	if err != nil {
+		panic(err)
 	}
+	return m
 }
 
 type StringFieldMapper struct {
-	translator map[string]mmdbtype.String
 	BaseFieldMapper
 }
 
+// NewStringFieldMapper creates the StringFieldMapper for a field
+// configuration. It panics if the configuration is invalid.
+//
+// Deprecated: Use NewFieldMapper, which returns an error instead.
 func NewStringFieldMapper(fc *FieldConfig) *StringFieldMapper {
-	var translator map[string]mmdbtype.String
-	if fc.Translate != nil {
-		translator = map[string]mmdbtype.String{}
-		for k, v := range fc.Translate {
-			translator[k] = mmdbtype.String(v)
-		}
-	}
+	return must(newStringFieldMapper(fc))
+}
 
-	return &StringFieldMapper{
-		translator:      translator,
-		BaseFieldMapper: *newBaseFieldMapper(fc),
+func newStringFieldMapper(fc *FieldConfig) (*StringFieldMapper, error) {
+	base, err := NewBaseFieldMapper(fc)
+	if err != nil {
+		return nil, err
 	}
+	return &StringFieldMapper{
+		BaseFieldMapper: *base,
+	}, nil
 }
 
 func (m *StringFieldMapper) Map(input string) (mmdbtype.DataType, error) {
-	res := m.Preprocess(input)
+	return m.Process(input, m.Parse)
+}
 
-	if m.translator != nil {
-		if v, ok := m.translator[res]; ok {
-			return v, nil
-		} else {
-			fmt.Printf("No translation for '%s' value '%s' with target field '%s'\n", m.Name, input, m.Target)
-		}
-	}
-	return mmdbtype.String(res), nil
+func (m *StringFieldMapper) Parse(input string) (mmdbtype.DataType, error) {
+	return mmdbtype.String(input), nil
 }
 
 type Int32FieldMapper struct {
 	BaseFieldMapper
 }
 
+// NewInt32FieldMapper creates the Int32FieldMapper for a field
+// configuration. It panics if the configuration is invalid.
+//
+// Deprecated: Use NewFieldMapper, which returns an error instead.
 func NewInt32FieldMapper(fc *FieldConfig) *Int32FieldMapper {
-	return &Int32FieldMapper{
-		BaseFieldMapper: *newBaseFieldMapper(fc),
+	return must(newInt32FieldMapper(fc))
+}
+
+func newInt32FieldMapper(fc *FieldConfig) (*Int32FieldMapper, error) {
+	base, err := NewBaseFieldMapper(fc)
+	if err != nil {
+		return nil, err
 	}
+	return &Int32FieldMapper{
+		BaseFieldMapper: *base,
+	}, nil
 }
 
 func (m *Int32FieldMapper) Map(input string) (mmdbtype.DataType, error) {
+	return m.Process(input, m.Parse)
+}
+
+func (m *Int32FieldMapper) Parse(input string) (mmdbtype.DataType, error) {
 	i, err := strconv.ParseInt(input, 10, 32)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Error converting field '%s' to int32: '%s'", m.Name, input)
@@ -165,16 +344,32 @@ type Uint16FieldMapper struct {
 	BaseFieldMapper
 }
 
+// NewUint16FieldMapper creates the Uint16FieldMapper for a field
+// configuration. It panics if the configuration is invalid.
+//
+// Deprecated: Use NewFieldMapper, which returns an error instead.
 func NewUint16FieldMapper(fc *FieldConfig) *Uint16FieldMapper {
-	return &Uint16FieldMapper{
-		BaseFieldMapper: *newBaseFieldMapper(fc),
+	return must(newUint16FieldMapper(fc))
+}
+
+func newUint16FieldMapper(fc *FieldConfig) (*Uint16FieldMapper, error) {
+	base, err := NewBaseFieldMapper(fc)
+	if err != nil {
+		return nil, err
 	}
+	return &Uint16FieldMapper{
+		BaseFieldMapper: *base,
+	}, nil
 }
 
 func (m *Uint16FieldMapper) Map(input string) (mmdbtype.DataType, error) {
+	return m.Process(input, m.Parse)
+}
+
+func (m *Uint16FieldMapper) Parse(input string) (mmdbtype.DataType, error) {
 	i, err := strconv.ParseUint(input, 10, 16)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Error converting field '%s' to int32: '%s'", m.Name, input)
+		return nil, errors.Wrapf(err, "Error converting field '%s' to uint16: '%s'", m.Name, input)
 	}
 	return mmdbtype.Uint16(i), nil
 }
@@ -183,16 +378,32 @@ type Uint32FieldMapper struct {
 	BaseFieldMapper
 }
 
+// NewUint32FieldMapper creates the Uint32FieldMapper for a field
+// configuration. It panics if the configuration is invalid.
+//
+// Deprecated: Use NewFieldMapper, which returns an error instead.
 func NewUint32FieldMapper(fc *FieldConfig) *Uint32FieldMapper {
-	return &Uint32FieldMapper{
-		BaseFieldMapper: *newBaseFieldMapper(fc),
+	return must(newUint32FieldMapper(fc))
+}
+
+func newUint32FieldMapper(fc *FieldConfig) (*Uint32FieldMapper, error) {
+	base, err := NewBaseFieldMapper(fc)
+	if err != nil {
+		return nil, err
 	}
+	return &Uint32FieldMapper{
+		BaseFieldMapper: *base,
+	}, nil
 }
 
 func (m *Uint32FieldMapper) Map(input string) (mmdbtype.DataType, error) {
+	return m.Process(input, m.Parse)
+}
+
+func (m *Uint32FieldMapper) Parse(input string) (mmdbtype.DataType, error) {
 	i, err := strconv.ParseUint(input, 10, 32)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Error converting field '%s' to int32: '%s'", m.Name, input)
+		return nil, errors.Wrapf(err, "Error converting field '%s' to uint32: '%s'", m.Name, input)
 	}
 	return mmdbtype.Uint32(i), nil
 }
@@ -201,36 +412,95 @@ type Uint64FieldMapper struct {
 	BaseFieldMapper
 }
 
+// NewUint64FieldMapper creates the Uint64FieldMapper for a field
+// configuration. It panics if the configuration is invalid.
+//
+// Deprecated: Use NewFieldMapper, which returns an error instead.
 func NewUint64FieldMapper(fc *FieldConfig) *Uint64FieldMapper {
-	return &Uint64FieldMapper{
-		BaseFieldMapper: *newBaseFieldMapper(fc),
+	return must(newUint64FieldMapper(fc))
+}
+
+func newUint64FieldMapper(fc *FieldConfig) (*Uint64FieldMapper, error) {
+	base, err := NewBaseFieldMapper(fc)
+	if err != nil {
+		return nil, err
 	}
+	return &Uint64FieldMapper{
+		BaseFieldMapper: *base,
+	}, nil
 }
 
 func (m *Uint64FieldMapper) Map(input string) (mmdbtype.DataType, error) {
+	return m.Process(input, m.Parse)
+}
+
+func (m *Uint64FieldMapper) Parse(input string) (mmdbtype.DataType, error) {
 	i, err := strconv.ParseUint(input, 10, 64)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Error converting field '%s' to int32: '%s'", m.Name, input)
+		return nil, errors.Wrapf(err, "Error converting field '%s' to uint64: '%s'", m.Name, input)
 	}
 	return mmdbtype.Uint64(i), nil
 }
 
 type BooleanFieldMapper struct {
+	// vocabulary maps lower-cased input values to booleans. If nil, input
+	// values are parsed using strconv.ParseBool.
+	vocabulary map[string]bool
 	BaseFieldMapper
 }
 
+// NewBooleanFieldMapper creates the BooleanFieldMapper for a field
+// configuration. It panics if the configuration is invalid.
+//
+// Deprecated: Use NewFieldMapper, which returns an error instead.
 func NewBooleanFieldMapper(fc *FieldConfig) *BooleanFieldMapper {
-	return &BooleanFieldMapper{
-		BaseFieldMapper: *newBaseFieldMapper(fc),
+	return must(newBooleanFieldMapper(fc))
+}
+
+func newBooleanFieldMapper(fc *FieldConfig) (*BooleanFieldMapper, error) {
+	base, err := NewBaseFieldMapper(fc)
+	if err != nil {
+		return nil, err
+	}
+
+	var vocabulary map[string]bool
+	if len(fc.TrueValues) > 0 || len(fc.FalseValues) > 0 {
+		vocabulary = map[string]bool{}
+		for _, v := range fc.TrueValues {
+			vocabulary[strings.ToLower(v)] = true
+		}
+		for _, v := range fc.FalseValues {
+			vocabulary[strings.ToLower(v)] = false
+		}
 	}
+
+	return &BooleanFieldMapper{
+		vocabulary:      vocabulary,
+		BaseFieldMapper: *base,
+	}, nil
 }
 
 func (m *BooleanFieldMapper) Map(input string) (mmdbtype.DataType, error) {
+	return m.Process(input, m.Parse)
+}
+
+func (m *BooleanFieldMapper) Parse(input string) (mmdbtype.DataType, error) {
 	var b bool
 	var err error
-	// TODO make this behavior optional
 	if input == "" {
+		switch m.EmptyMode {
+		case EmptyModeOmitValue:
+			return nil, ErrOmitValue
+		case EmptyModeError:
+			return nil, fmt.Errorf("Error converting field '%s' to bool: empty value", m.Name)
+		}
 		b = false
+	} else if m.vocabulary != nil {
+		var ok bool
+		b, ok = m.vocabulary[strings.ToLower(input)]
+		if !ok {
+			return nil, fmt.Errorf("Error converting field '%s' to bool: '%s' is neither a true nor a false value", m.Name, input)
+		}
 	} else {
 		b, err = strconv.ParseBool(input)
 		if err != nil {
@@ -238,10 +508,6 @@ func (m *BooleanFieldMapper) Map(input string) (mmdbtype.DataType, error) {
 		}
 	}
 
-	if !b && m.OmitZeroValue {
-		return nil, nil
-	}
-
 	return mmdbtype.Bool(b), nil
 }
 
@@ -249,44 +515,281 @@ type Float32FieldMapper struct {
 	BaseFieldMapper
 }
 
+// NewFloat32FieldMapper creates the Float32FieldMapper for a field
+// configuration. It panics if the configuration is invalid.
+//
+// Deprecated: Use NewFieldMapper, which returns an error instead.
 func NewFloat32FieldMapper(fc *FieldConfig) *Float32FieldMapper {
-	return &Float32FieldMapper{
-		BaseFieldMapper: *newBaseFieldMapper(fc),
+	return must(newFloat32FieldMapper(fc))
+}
+
+func newFloat32FieldMapper(fc *FieldConfig) (*Float32FieldMapper, error) {
+	base, err := NewBaseFieldMapper(fc)
+	if err != nil {
+		return nil, err
 	}
+	return &Float32FieldMapper{
+		BaseFieldMapper: *base,
+	}, nil
 }
 
 func (m *Float32FieldMapper) Map(input string) (mmdbtype.DataType, error) {
+	return m.Process(input, m.Parse)
+}
+
+func (m *Float32FieldMapper) Parse(input string) (mmdbtype.DataType, error) {
 	v, err := strconv.ParseFloat(input, 32)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Error converting field '%s' to float32: '%s'", m.Name, input)
 	}
 
-	if v == 0 && m.OmitZeroValue {
-		return nil, nil
-	}
-
-	return mmdbtype.Float32(v), nil
+	return mmdbtype.Float32(m.round(v)), nil
 }
 
 type Float64FieldMapper struct {
 	BaseFieldMapper
 }
 
+// NewFloat64FieldMapper creates the Float64FieldMapper for a field
+// configuration. It panics if the configuration is invalid.
+//
+// Deprecated: Use NewFieldMapper, which returns an error instead.
 func NewFloat64FieldMapper(fc *FieldConfig) *Float64FieldMapper {
-	return &Float64FieldMapper{
-		BaseFieldMapper: *newBaseFieldMapper(fc),
+	return must(newFloat64FieldMapper(fc))
+}
+
+func newFloat64FieldMapper(fc *FieldConfig) (*Float64FieldMapper, error) {
+	base, err := NewBaseFieldMapper(fc)
+	if err != nil {
+		return nil, err
 	}
+	return &Float64FieldMapper{
+		BaseFieldMapper: *base,
+	}, nil
 }
 
 func (m *Float64FieldMapper) Map(input string) (mmdbtype.DataType, error) {
+	return m.Process(input, m.Parse)
+}
+
+func (m *Float64FieldMapper) Parse(input string) (mmdbtype.DataType, error) {
 	v, err := strconv.ParseFloat(input, 64)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Error converting field '%s' to float32: '%s'", m.Name, input)
+		return nil, errors.Wrapf(err, "Error converting field '%s' to float64: '%s'", m.Name, input)
 	}
+	v = m.round(v)
 
-	if v == 0 && m.OmitZeroValue {
-		return nil, nil
+	// store as float32 if that doesn't change the value at the configured
+	// precision
+	if m.AllowFloat32 && m.round(float64(float32(v))) == v {
+		return mmdbtype.Float32(v), nil
 	}
 
 	return mmdbtype.Float64(v), nil
 }
+
+// round rounds `v` to the configured number of decimal places, using the
+// configured rounding mode. If no precision is configured, `v` is returned
+// unchanged.
+func (m *BaseFieldMapper) round(v float64) float64 {
+	if m.Precision == nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		return v
+	}
+
+	scale := math.Pow10(*m.Precision)
+	scaled := v * scale
+	switch m.RoundingMode {
+	case RoundingModeHalfEven:
+		scaled = math.RoundToEven(scaled)
+	case RoundingModeTowardZero:
+		scaled = math.Trunc(scaled)
+	case RoundingModeFloor:
+		scaled = math.Floor(scaled)
+	case RoundingModeCeil:
+		scaled = math.Ceil(scaled)
+	default:
+		scaled = math.Round(scaled)
+	}
+	// small negative values are rounded to negative zero, which would be
+	// written as such
+	if scaled == 0 {
+		return 0
+	}
+	return scaled / scale
+}
+
+type Uint128FieldMapper struct {
+	BaseFieldMapper
+}
+
+func NewUint128FieldMapper(fc *FieldConfig) (*Uint128FieldMapper, error) {
+	base, err := NewBaseFieldMapper(fc)
+	if err != nil {
+		return nil, err
+	}
+	return &Uint128FieldMapper{
+		BaseFieldMapper: *base,
+	}, nil
+}
+
+func (m *Uint128FieldMapper) Map(input string) (mmdbtype.DataType, error) {
+	return m.Process(input, m.Parse)
+}
+
+// Parse accepts decimal values, as well as hexadecimal values prefixed with
+// "0x".
+func (m *Uint128FieldMapper) Parse(input string) (mmdbtype.DataType, error) {
+	base := 10
+	digits := input
+	if strings.HasPrefix(input, "0x") || strings.HasPrefix(input, "0X") {
+		base = 16
+		digits = input[2:]
+	}
+
+	i, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return nil, fmt.Errorf("Error converting field '%s' to uint128: '%s'", m.Name, input)
+	}
+	if i.Sign() < 0 || i.BitLen() > 128 {
+		return nil, fmt.Errorf("Error converting field '%s' to uint128: '%s' is out of range", m.Name, input)
+	}
+	return (*mmdbtype.Uint128)(i), nil
+}
+
+type BytesFieldMapper struct {
+	BaseFieldMapper
+}
+
+func NewBytesFieldMapper(fc *FieldConfig) (*BytesFieldMapper, error) {
+	base, err := NewBaseFieldMapper(fc)
+	if err != nil {
+		return nil, err
+	}
+	return &BytesFieldMapper{
+		BaseFieldMapper: *base,
+	}, nil
+}
+
+func (m *BytesFieldMapper) Map(input string) (mmdbtype.DataType, error) {
+	return m.Process(input, m.Parse)
+}
+
+// Parse decodes the value according to the field's encoding.
+func (m *BytesFieldMapper) Parse(input string) (mmdbtype.DataType, error) {
+	var b []byte
+	var err error
+	switch m.Encoding {
+	case EncodingBase64:
+		b, err = base64.StdEncoding.DecodeString(input)
+	case EncodingBase64URL:
+		b, err = base64.URLEncoding.DecodeString(input)
+	default:
+		b, err = hex.DecodeString(input)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error converting field '%s' to bytes: '%s'", m.Name, input)
+	}
+	return mmdbtype.Bytes(b), nil
+}
+
+// JSONFieldMapper parses JSON values, usually objects or arrays, into the
+// corresponding mmdb types. Integral numbers are stored as the smallest
+// fitting one of uint32, uint64 and int32, all other numbers as float64.
+// Object members and array elements that are null are omitted.
+type JSONFieldMapper struct {
+	BaseFieldMapper
+}
+
+func NewJSONFieldMapper(fc *FieldConfig) (*JSONFieldMapper, error) {
+	base, err := NewBaseFieldMapper(fc)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONFieldMapper{
+		BaseFieldMapper: *base,
+	}, nil
+}
+
+func (m *JSONFieldMapper) Map(input string) (mmdbtype.DataType, error) {
+	return m.Process(input, m.Parse)
+}
+
+func (m *JSONFieldMapper) Parse(input string) (mmdbtype.DataType, error) {
+	d := json.NewDecoder(bytes.NewReader([]byte(input)))
+	d.UseNumber()
+
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, errors.Wrapf(err, "Error converting field '%s' from JSON: '%s'", m.Name, input)
+	}
+	if d.More() {
+		return nil, fmt.Errorf("Error converting field '%s' from JSON: trailing data in '%s'", m.Name, input)
+	}
+
+	res, err := jsonToDataType(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error converting field '%s' from JSON: '%s'", m.Name, input)
+	}
+	if res == nil {
+		return nil, ErrOmitValue
+	}
+	return res, nil
+}
+
+// jsonToDataType converts a value decoded by encoding/json, with UseNumber
+// enabled, to the corresponding mmdb type. A nil result indicates a JSON
+// null value.
+func jsonToDataType(v interface{}) (mmdbtype.DataType, error) {
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return mmdbtype.Bool(t), nil
+	case string:
+		return mmdbtype.String(t), nil
+	case json.Number:
+		return jsonNumberToDataType(t)
+	case []interface{}:
+		s := make(mmdbtype.Slice, 0, len(t))
+		for _, e := range t {
+			ev, err := jsonToDataType(e)
+			if err != nil {
+				return nil, err
+			}
+			if ev != nil {
+				s = append(s, ev)
+			}
+		}
+		return s, nil
+	case map[string]interface{}:
+		r := make(mmdbtype.Map, len(t))
+		for k, e := range t {
+			ev, err := jsonToDataType(e)
+			if err != nil {
+				return nil, err
+			}
+			if ev != nil {
+				r[mmdbtype.String(k)] = ev
+			}
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("unsupported JSON value of type %T", v)
+}
+
+func jsonNumberToDataType(n json.Number) (mmdbtype.DataType, error) {
+	if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		if u <= math.MaxUint32 {
+			return mmdbtype.Uint32(u), nil
+		}
+		return mmdbtype.Uint64(u), nil
+	}
+	if i, err := strconv.ParseInt(n.String(), 10, 32); err == nil {
+		return mmdbtype.Int32(i), nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, err
+	}
+	return mmdbtype.Float64(f), nil
+}
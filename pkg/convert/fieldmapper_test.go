@@ -0,0 +1,65 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// testFieldConfig decodes and validates the field configuration `field`.
+func testFieldConfig(t *testing.T, field string) *FieldConfig {
+	t.Helper()
+	fc := &FieldConfig{Name: "f", Target: "f"}
+	if err := yaml.Unmarshal([]byte(field), fc); err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return fc
+}
+
+func TestPreprocess(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		input string
+		want  string
+		err   string
+	}{
+		{"trim before extract", "trim: true\nextract: '^AS(\\d+)$'", " AS123 ", "123", ""},
+		{"normalize before extract", "normalize: NFKC\nextract: '^AS(\\d+)$'", "ＡＳ１２３", "123", ""},
+		{"transliterate before extract", "transliterate: true\nextract: '^([a-z]+)'", "zürich", "zurich", ""},
+		{"collapse before extract", "collapseWhitespace: true\nextract: '^a b$'", " a \t b ", "a b", ""},
+		{"whole match without group", "extract: '\\d+'", "AS123 Foo", "123", ""},
+		{"no match", "extract: '^AS(\\d+)$'", "123", "", "doesn't match extract pattern"},
+		{"extract before replace", "extract: '^\\w+ (.*)$'\nreplace: [{pattern: '^(\\w+)', replacement: 'x$1'}]", "a b c", "xb c", ""},
+		{"replacements in order", "replace: [{pattern: a, replacement: b}, {pattern: b, replacement: c}]", "ab", "cc", ""},
+		{"replace before translate", "replace: [{pattern: '-', replacement: ' '}]\ntranslate: {north america: NA}", "north-america", "NA", ""},
+		{"translate before capitalize", "translate: {at: austria}\ncapitalization: title", "at", "Austria", ""},
+		{"trim before translate", "trim: true\ntranslate: {at: austria}", " at ", "austria", ""},
+		{"untrimmed", "", " at ", " at ", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := NewBaseFieldMapper(testFieldConfig(t, test.field))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := m.Preprocess(test.input)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %q, error %v, want error %q", got, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
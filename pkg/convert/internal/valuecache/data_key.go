@@ -2,36 +2,96 @@ package valuecache
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"encoding/binary"
 	"hash"
+	"hash/fnv"
 
 	"github.com/maxmind/mmdbwriter/mmdbtype"
 )
 
+// dataMapKey is a 128-bit FNV-1a hash identifying a value. Keys of maps and
+// slices are derived from the keys of their elements, so each value is only
+// serialized and hashed once, no matter how deeply it is nested.
+type dataMapKey [16]byte
+
+const (
+	kindScalar byte = iota
+	kindMap
+	kindSlice
+)
+
 // keyWriter is similar to dataWriter but it will never use pointers. This
 // will produce a unique key for the type.
 type keyWriter struct {
 	*bytes.Buffer
-	sha256 hash.Hash
+	hash hash.Hash
+}
+
+type mapEntryKey struct {
+	name mmdbtype.String
+	key  dataMapKey
 }
 
 func newKeyWriter() *keyWriter {
-	return &keyWriter{Buffer: &bytes.Buffer{}, sha256: sha256.New()}
+	return &keyWriter{Buffer: &bytes.Buffer{}, hash: fnv.New128a()}
+}
+
+// scalarKey returns the key of a value which is neither a map nor a slice.
+func (kw *keyWriter) scalarKey(t mmdbtype.DataType) (dataMapKey, error) {
+	kw.Truncate(0)
+	kw.WriteByte(kindScalar)
+	if _, err := t.WriteTo(kw); err != nil {
+		return dataMapKey{}, err
+	}
+	return kw.sum(), nil
 }
 
-// This is just a quick hack. I am sure there is
-// something better.
-func (kw *keyWriter) key(t mmdbtype.DataType) ([]byte, error) {
+// mapKey returns the key of a map with the entries `entries`. The key doesn't
+// depend on the order of the entries, which are sorted in place.
+func (kw *keyWriter) mapKey(entries []mapEntryKey) (dataMapKey, error) {
+	// maps are small, so insertion sort beats sort.Slice
+	for i := 1; i < len(entries); i++ {
+		for j := i; j > 0 && entries[j].name < entries[j-1].name; j-- {
+			entries[j], entries[j-1] = entries[j-1], entries[j]
+		}
+	}
+
 	kw.Truncate(0)
-	kw.sha256.Reset()
-	_, err := t.WriteTo(kw)
-	if err != nil {
-		return nil, err
+	kw.WriteByte(kindMap)
+	kw.writeLength(len(entries))
+	for _, e := range entries {
+		// strings are written with their length, so names can't be
+		// confused with the keys following them
+		if _, err := e.name.WriteTo(kw); err != nil {
+			return dataMapKey{}, err
+		}
+		kw.Write(e.key[:])
 	}
-	if _, err := kw.WriteTo(kw.sha256); err != nil {
-		return nil, err
+	return kw.sum(), nil
+}
+
+// sliceKey returns the key of a slice, whose elements have the keys `keys`.
+func (kw *keyWriter) sliceKey(keys []dataMapKey) dataMapKey {
+	kw.Truncate(0)
+	kw.WriteByte(kindSlice)
+	kw.writeLength(len(keys))
+	for _, key := range keys {
+		kw.Write(key[:])
 	}
-	return kw.sha256.Sum(nil), nil
+	return kw.sum()
+}
+
+func (kw *keyWriter) writeLength(n int) {
+	var b [binary.MaxVarintLen64]byte
+	kw.Write(b[:binary.PutUvarint(b[:], uint64(n))])
+}
+
+func (kw *keyWriter) sum() dataMapKey {
+	var key dataMapKey
+	kw.hash.Reset()
+	kw.hash.Write(kw.Bytes())
+	kw.hash.Sum(key[:0])
+	return key
 }
 
 func (kw *keyWriter) WriteOrWritePointer(t mmdbtype.DataType) (int64, error) {
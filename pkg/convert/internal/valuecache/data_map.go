@@ -1,8 +1,10 @@
 package valuecache
 
-import "github.com/maxmind/mmdbwriter/mmdbtype"
+import (
+	"math"
 
-type dataMapKey string
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
 
 // Please note, if you change the order of these fields, please check
 // alignment as we end up storing quite a few in memory.
@@ -16,64 +18,86 @@ type dataMapValue struct {
 	refCount uint32
 }
 
+// RefCount returns the number of times the value has been stored.
+func (v *dataMapValue) RefCount() uint32 {
+	return v.refCount
+}
+
 // dataMap is used to deduplicate data inserted into the tree to reduce
 // memory usage using keys generated by keyWriter.
 type DataMap struct {
 	data      map[dataMapKey]*dataMapValue
 	keyWriter *keyWriter
+	// scalarKeys memoizes the keys of scalar values, so repeated values
+	// don't have to be serialized and hashed again. It is cleared once it
+	// holds maxScalarKeys keys.
+	scalarKeys map[mmdbtype.DataType]dataMapKey
+	// entries is used as a stack holding the entries of the maps whose keys
+	// are being computed, so nested maps don't need their own allocations
+	entries []mapEntryKey
 }
 
+// maxScalarKeys is the maximum number of scalar keys memoized by a DataMap.
+// Frequent values are memoized again soon after the memo was cleared.
+const maxScalarKeys = 1 << 16
+
 func NewDataMap() *DataMap {
 	return &DataMap{
-		data:      map[dataMapKey]*dataMapValue{},
-		keyWriter: newKeyWriter(),
+		data:       map[dataMapKey]*dataMapValue{},
+		keyWriter:  newKeyWriter(),
+		scalarKeys: map[mmdbtype.DataType]dataMapKey{},
 	}
 }
 
 // store stores the value in the dataMap and returns the dataMapValue for it.
 // If the value is already in the dataMap, the reference count for it is
-// incremented.
+// incremented. Maps and slices are stored bottom-up, replacing their
+// elements by the stored ones, so each nested value is only hashed once.
 func (dm *DataMap) Store(v mmdbtype.DataType) (*dataMapValue, error) {
-	key, err := dm.keyWriter.key(v)
-	if err != nil {
-		return nil, err
-	}
-
-	dmv, ok := dm.data[dataMapKey(key)]
-	if !ok {
-		dmKey := dataMapKey(key)
-		dmv = &dataMapValue{
-			key:  dmKey,
-			Data: v,
-		}
-		dm.data[dmKey] = dmv
-	}
-
-	dmv.refCount++
-
-	switch v.(type) {
+	var key dataMapKey
+	var err error
+	switch t := v.(type) {
 	case mmdbtype.Map:
-		vm := v.(mmdbtype.Map)
-		for mk, mv := range vm {
+		start := len(dm.entries)
+		for mk, mv := range t {
 			cv, err := dm.Store(mv)
 			if err != nil {
+				dm.entries = dm.entries[:start]
 				return nil, err
 			}
-			vm[mk] = cv.Data
+			t[mk] = cv.Data
+			dm.entries = append(dm.entries, mapEntryKey{name: mk, key: cv.key})
 		}
-		break
+		key, err = dm.keyWriter.mapKey(dm.entries[start:])
+		dm.entries = dm.entries[:start]
 	case mmdbtype.Slice:
-		va := v.(mmdbtype.Slice)
-		for ai, av := range va {
+		keys := make([]dataMapKey, len(t))
+		for ai, av := range t {
 			ev, err := dm.Store(av)
 			if err != nil {
 				return nil, err
 			}
-			va[ai] = ev.Data
+			t[ai] = ev.Data
+			keys[ai] = ev.key
 		}
-		break
+		key = dm.keyWriter.sliceKey(keys)
+	default:
+		key, err = dm.scalarKey(v)
+	}
+	if err != nil {
+		return nil, err
 	}
 
+	dmv, ok := dm.data[key]
+	if !ok {
+		dmv = &dataMapValue{
+			key:  key,
+			Data: v,
+		}
+		dm.data[key] = dmv
+	}
+
+	dmv.refCount++
 	return dmv, nil
 }
 
@@ -89,34 +113,97 @@ func (dm *DataMap) Remove(v *dataMapValue) {
 
 	if v.refCount == 0 {
 		delete(dm.data, v.key)
+		if memoizable(v.Data) {
+			delete(dm.scalarKeys, v.Data)
+		}
 	}
 
-	switch v.Data.(type) {
+	switch t := v.Data.(type) {
 	case mmdbtype.Map:
-		vm := v.Data.(mmdbtype.Map)
-		for _, mv := range vm {
-			key, err := dm.keyWriter.key(mv)
+		for _, mv := range t {
+			dm.removeValue(mv)
+		}
+	case mmdbtype.Slice:
+		for _, av := range t {
+			dm.removeValue(av)
+		}
+	}
+}
+
+// removeValue removes a reference to the stored value `v`.
+func (dm *DataMap) removeValue(v mmdbtype.DataType) {
+	key, err := dm.key(v)
+	if err != nil {
+		return
+	}
+	if cv, ok := dm.data[key]; ok {
+		dm.Remove(cv)
+	}
+}
+
+// key returns the key of `v`, without storing it.
+func (dm *DataMap) key(v mmdbtype.DataType) (dataMapKey, error) {
+	switch t := v.(type) {
+	case mmdbtype.Map:
+		start := len(dm.entries)
+		defer func() { dm.entries = dm.entries[:start] }()
+		for mk, mv := range t {
+			key, err := dm.key(mv)
 			if err != nil {
-				return
-			}
-			cv, ok := dm.data[dataMapKey(key)]
-			if ok {
-				dm.Remove(cv)
+				return dataMapKey{}, err
 			}
+			dm.entries = append(dm.entries, mapEntryKey{name: mk, key: key})
 		}
-		break
+		return dm.keyWriter.mapKey(dm.entries[start:])
 	case mmdbtype.Slice:
-		va := v.Data.(mmdbtype.Slice)
-		for _, av := range va {
-			key, err := dm.keyWriter.key(av)
+		keys := make([]dataMapKey, len(t))
+		for ai, av := range t {
+			key, err := dm.key(av)
 			if err != nil {
-				return
-			}
-			cv, ok := dm.data[dataMapKey(key)]
-			if ok {
-				dm.Remove(cv)
+				return dataMapKey{}, err
 			}
+			keys[ai] = key
 		}
-		break
+		return dm.keyWriter.sliceKey(keys), nil
+	}
+	return dm.scalarKey(v)
+}
+
+func (dm *DataMap) scalarKey(v mmdbtype.DataType) (dataMapKey, error) {
+	if !memoizable(v) {
+		return dm.keyWriter.scalarKey(v)
+	}
+	if key, ok := dm.scalarKeys[v]; ok {
+		return key, nil
+	}
+	key, err := dm.keyWriter.scalarKey(v)
+	if err != nil {
+		return dataMapKey{}, err
 	}
+	if len(dm.scalarKeys) >= maxScalarKeys {
+		dm.scalarKeys = map[mmdbtype.DataType]dataMapKey{}
+	}
+	dm.scalarKeys[v] = key
+	return key, nil
+}
+
+// memoizable reports whether the key of `v` can be memoized. This requires
+// `v` to be usable as map key, and to be equal only to values serialized
+// the same way. This rules out NaN, which isn't equal to itself, and
+// negative zero, which is equal to zero.
+func memoizable(v mmdbtype.DataType) bool {
+	switch t := v.(type) {
+	case mmdbtype.String, mmdbtype.Bool, mmdbtype.Int32, mmdbtype.Uint16,
+		mmdbtype.Uint32, mmdbtype.Uint64:
+		return true
+	case mmdbtype.Float32:
+		return memoizableFloat(float64(t))
+	case mmdbtype.Float64:
+		return memoizableFloat(float64(t))
+	}
+	return false
+}
+
+func memoizableFloat(f float64) bool {
+	return !math.IsNaN(f) && !(f == 0 && math.Signbit(f))
 }
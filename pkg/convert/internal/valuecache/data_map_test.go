@@ -0,0 +1,200 @@
+package valuecache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"math"
+	"testing"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+func TestDataMapStoreDeduplicatesNestedValues(t *testing.T) {
+	dm := NewDataMap()
+	a, err := dm.Store(newTestRecord(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := dm.Store(newTestRecord(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b || b.RefCount() != 2 {
+		t.Fatalf("equal records weren't deduplicated")
+	}
+
+	c, err := dm.Store(newTestRecord(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == c {
+		t.Fatalf("different records were deduplicated")
+	}
+}
+
+func TestDataMapStoreKeepsNegativeZero(t *testing.T) {
+	negZero := math.Copysign(0, -1)
+	for _, values := range [][2]mmdbtype.DataType{
+		{mmdbtype.Float32(0), mmdbtype.Float32(negZero)},
+		{mmdbtype.Float64(0), mmdbtype.Float64(negZero)},
+	} {
+		dm := NewDataMap()
+		for i := 0; i < 2; i++ {
+			zero, err := dm.Store(values[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			neg, err := dm.Store(values[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if zero == neg {
+				t.Fatalf("%T zero and negative zero were deduplicated", values[0])
+			}
+		}
+	}
+}
+
+func BenchmarkDataMapStore(b *testing.B) {
+	dm := NewDataMap()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := dm.Store(newTestRecord(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDataMapStoreSHA256 is the baseline for BenchmarkDataMapStore,
+// see sha256DataMap.
+func BenchmarkDataMapStoreSHA256(b *testing.B) {
+	dm := newSHA256DataMap()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dm.Store(newTestRecord(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// testRecordVariants is the number of distinct records created by
+// newTestRecord, similar to the number of cities in a small city database.
+const testRecordVariants = 2000
+
+var (
+	testCities    [testRecordVariants]mmdbtype.String
+	testCountries [50]mmdbtype.String
+)
+
+func init() {
+	for i := range testCities {
+		testCities[i] = mmdbtype.String(fmt.Sprintf("City %d", i))
+	}
+	for i := range testCountries {
+		testCountries[i] = mmdbtype.String(fmt.Sprintf("C%d", i))
+	}
+}
+
+// newTestRecord creates a city record, as mapped from the row `i`.
+func newTestRecord(i int) mmdbtype.Map {
+	city := i % testRecordVariants
+	country := testCountries[city%len(testCountries)]
+	return mmdbtype.Map{
+		"city": mmdbtype.Map{
+			"names": mmdbtype.Map{
+				"en": testCities[city],
+				"de": testCities[city],
+			},
+		},
+		"country": mmdbtype.Map{
+			"iso_code": country,
+			"names":    mmdbtype.Map{"en": country},
+		},
+		"location": mmdbtype.Map{
+			"latitude":        mmdbtype.Float64(float64(city) / 100),
+			"longitude":       mmdbtype.Float64(float64(city) / 50),
+			"accuracy_radius": mmdbtype.Uint16(100),
+		},
+		"subdivisions": mmdbtype.Slice{
+			mmdbtype.Map{"iso_code": country},
+		},
+	}
+}
+
+// sha256DataMap is the DataMap as it was before keys were derived from the
+// keys of nested values: each value is serialized and hashed using SHA-256,
+// on every level it is nested in.
+type sha256DataMap struct {
+	data map[string]*dataMapValue
+	kw   *sha256KeyWriter
+}
+
+func newSHA256DataMap() *sha256DataMap {
+	return &sha256DataMap{
+		data: map[string]*dataMapValue{},
+		kw:   &sha256KeyWriter{Buffer: &bytes.Buffer{}, hash: sha256.New()},
+	}
+}
+
+func (dm *sha256DataMap) Store(v mmdbtype.DataType) error {
+	_, err := dm.store(v)
+	return err
+}
+
+func (dm *sha256DataMap) store(v mmdbtype.DataType) (*dataMapValue, error) {
+	key, err := dm.kw.key(v)
+	if err != nil {
+		return nil, err
+	}
+	dmv, ok := dm.data[key]
+	if !ok {
+		dmv = &dataMapValue{Data: v}
+		dm.data[key] = dmv
+	}
+	dmv.refCount++
+
+	switch t := v.(type) {
+	case mmdbtype.Map:
+		for mk, mv := range t {
+			cv, err := dm.store(mv)
+			if err != nil {
+				return nil, err
+			}
+			t[mk] = cv.Data
+		}
+	case mmdbtype.Slice:
+		for ai, av := range t {
+			ev, err := dm.store(av)
+			if err != nil {
+				return nil, err
+			}
+			t[ai] = ev.Data
+		}
+	}
+	return dmv, nil
+}
+
+type sha256KeyWriter struct {
+	*bytes.Buffer
+	hash hash.Hash
+}
+
+func (kw *sha256KeyWriter) key(t mmdbtype.DataType) (string, error) {
+	kw.Truncate(0)
+	kw.hash.Reset()
+	if _, err := t.WriteTo(kw); err != nil {
+		return "", err
+	}
+	if _, err := kw.WriteTo(kw.hash); err != nil {
+		return "", err
+	}
+	return string(kw.hash.Sum(nil)), nil
+}
+
+func (kw *sha256KeyWriter) WriteOrWritePointer(t mmdbtype.DataType) (int64, error) {
+	return t.WriteTo(kw)
+}
@@ -0,0 +1,68 @@
+package valuecache
+
+import (
+	"bytes"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+type writtenValue struct {
+	pointer mmdbtype.Pointer
+	size    int64
+}
+
+// DataWriter writes the data section of a database. Like mmdbwriter does
+// when writing a tree, each record is written once, and nested values that
+// have been written before are replaced by pointers, if these are smaller.
+type DataWriter struct {
+	*bytes.Buffer
+	dm      *DataMap
+	offsets map[dataMapKey]writtenValue
+}
+
+func NewDataWriter() *DataWriter {
+	return &DataWriter{
+		Buffer:  &bytes.Buffer{},
+		dm:      NewDataMap(),
+		offsets: map[dataMapKey]writtenValue{},
+	}
+}
+
+// WriteRecord writes the record `v`, unless an equal record has been written
+// before, and returns its offset within the data section.
+func (dw *DataWriter) WriteRecord(v mmdbtype.DataType) (int, error) {
+	key, err := dw.dm.key(v)
+	if err != nil {
+		return 0, err
+	}
+	if written, ok := dw.offsets[key]; ok {
+		return int(written.pointer), nil
+	}
+
+	offset := dw.Len()
+	size, err := v.WriteTo(dw)
+	if err != nil {
+		return 0, err
+	}
+	dw.offsets[key] = writtenValue{pointer: mmdbtype.Pointer(offset), size: size}
+	return offset, nil
+}
+
+func (dw *DataWriter) WriteOrWritePointer(t mmdbtype.DataType) (int64, error) {
+	key, err := dw.dm.key(t)
+	if err != nil {
+		return 0, err
+	}
+	written, ok := dw.offsets[key]
+	if ok && written.size > written.pointer.WrittenSize() {
+		return written.pointer.WriteTo(dw)
+	}
+
+	offset := dw.Len()
+	size, err := t.WriteTo(dw)
+	if err != nil || ok {
+		return size, err
+	}
+	dw.offsets[key] = writtenValue{pointer: mmdbtype.Pointer(offset), size: size}
+	return size, nil
+}
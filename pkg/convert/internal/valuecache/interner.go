@@ -0,0 +1,30 @@
+package valuecache
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// Interner deduplicates string values as they are created, so equal values
+// share memory before records are built from them. Interned values are
+// copied, so they don't keep the larger strings they were sliced from, e.g.
+// a whole input line, alive. It is safe for concurrent use.
+type Interner struct {
+	strings sync.Map
+}
+
+func NewInterner() *Interner {
+	return &Interner{}
+}
+
+// String returns the interned value equal to `s`.
+func (in *Interner) String(s mmdbtype.String) mmdbtype.String {
+	if v, ok := in.strings.Load(s); ok {
+		return v.(mmdbtype.String)
+	}
+	c := mmdbtype.String(strings.Clone(string(s)))
+	v, _ := in.strings.LoadOrStore(c, c)
+	return v.(mmdbtype.String)
+}
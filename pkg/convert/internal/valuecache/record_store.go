@@ -0,0 +1,45 @@
+package valuecache
+
+import "github.com/maxmind/mmdbwriter/mmdbtype"
+
+// RecordStore assigns IDs to records, storing each distinct record, as well
+// as each distinct nested value, only once. IDs are assigned consecutively,
+// starting at 0.
+type RecordStore struct {
+	dm      *DataMap
+	ids     map[dataMapKey]uint32
+	records []mmdbtype.DataType
+}
+
+func NewRecordStore() *RecordStore {
+	return &RecordStore{
+		dm:  NewDataMap(),
+		ids: map[dataMapKey]uint32{},
+	}
+}
+
+// Store returns the ID of the record `v`, storing it if it hasn't been
+// stored before.
+func (s *RecordStore) Store(v mmdbtype.DataType) (uint32, error) {
+	dmv, err := s.dm.Store(v)
+	if err != nil {
+		return 0, err
+	}
+	if id, ok := s.ids[dmv.key]; ok {
+		return id, nil
+	}
+	id := uint32(len(s.records))
+	s.ids[dmv.key] = id
+	s.records = append(s.records, dmv.Data)
+	return id, nil
+}
+
+// Get returns the record with ID `id`.
+func (s *RecordStore) Get(id uint32) mmdbtype.DataType {
+	return s.records[id]
+}
+
+// Len returns the number of distinct records stored.
+func (s *RecordStore) Len() int {
+	return len(s.records)
+}
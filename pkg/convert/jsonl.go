@@ -0,0 +1,190 @@
+package convert
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	InputFormatCSV   = "csv"
+	InputFormatJSONL = "jsonl"
+)
+
+// Properties holding the IP range of a JSONL row.
+const (
+	JSON_NETWORK  string = "network"
+	JSON_START_IP string = "start_ip"
+	JSON_END_IP   string = "end_ip"
+)
+
+// newInputSource returns the RowSource reading `input` in the format
+// `format`, one of the InputFormat* constants. It defaults to CSV.
+func newInputSource(format string, input io.Reader) RowSource {
+	if format == InputFormatJSONL {
+		return NewJSONLSource(input)
+	}
+	return NewCSVSource(input)
+}
+
+// JSONLSource is a RowSource reading JSON Lines, i.e. one JSON object per
+// line. The range of a row is given by either its JSON_NETWORK property,
+// holding a CIDR, or its JSON_START_IP and JSON_END_IP properties, holding
+// IP addresses or integers.
+//
+// Columns are JSON paths, whose components are separated by dots, e.g.
+// `asn.number`. Components address either object members or array
+// elements, by index. Nested objects and arrays are returned as JSON, so
+// they can be copied into records verbatim using the `json` field type.
+// JSON nulls are treated like missing properties.
+//
+// Rows are decoded once they are mapped, so this is done concurrently.
+type JSONLSource struct {
+	reader *bufio.Reader
+}
+
+func NewJSONLSource(input io.Reader) *JSONLSource {
+	return &JSONLSource{reader: bufio.NewReader(input)}
+}
+
+// Columns returns nil, as JSON Lines have no header.
+func (s *JSONLSource) Columns() ([]string, error) {
+	return nil, nil
+}
+
+func (s *JSONLSource) Next() (Row, error) {
+	for {
+		line, err := s.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrap(err, "error reading JSON Lines")
+		}
+		// skip blank lines, e.g. following the last row
+		if len(bytes.TrimSpace(line)) > 0 {
+			return &jsonlRow{line: line}, nil
+		}
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+	}
+}
+
+// jsonlRow is a row read by JSONLSource.
+type jsonlRow struct {
+	line   []byte
+	once   sync.Once
+	values map[string]interface{}
+	err    error
+}
+
+// decode decodes the row's line, if it hasn't been decoded yet.
+func (r *jsonlRow) decode() error {
+	r.once.Do(func() {
+		d := json.NewDecoder(bytes.NewReader(r.line))
+		d.UseNumber()
+		if err := d.Decode(&r.values); err != nil {
+			r.err = errors.Wrap(err, "Error decoding JSON object")
+		} else if d.More() {
+			r.err = fmt.Errorf("Error decoding JSON object: trailing data in '%s'", bytes.TrimSpace(r.line))
+		} else if r.values == nil {
+			r.err = fmt.Errorf("Error decoding JSON object: expecting an object, found '%s'", bytes.TrimSpace(r.line))
+		}
+	})
+	return r.err
+}
+
+func (r *jsonlRow) Range() (net.IP, net.IP, error) {
+	if err := r.decode(); err != nil {
+		return nil, nil, err
+	}
+
+	if network, ok := r.Value(JSON_NETWORK); ok {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Error parsing network: %s", network)
+		}
+		start := ipNet.IP.To4()
+		if start == nil {
+			return nil, nil, fmt.Errorf("network %s isn't an IPv4 network", network)
+		}
+		end := make(net.IP, len(start))
+		for i := range start {
+			end[i] = start[i] | ^ipNet.Mask[i]
+		}
+		return start, end, nil
+	}
+
+	start, err := r.ip(JSON_START_IP)
+	if err != nil {
+		return nil, nil, err
+	}
+	end, err := r.ip(JSON_END_IP)
+	if err != nil {
+		return nil, nil, err
+	}
+	return start, end, nil
+}
+
+// ip returns the IP address held by the property `name`, either as IP
+// address or as integer.
+func (r *jsonlRow) ip(name string) (net.IP, error) {
+	v, ok := r.Value(name)
+	if !ok {
+		return nil, fmt.Errorf("expecting either '%s', or '%s' and '%s' in JSON object", JSON_NETWORK, JSON_START_IP, JSON_END_IP)
+	}
+	if i, err := strconv.ParseUint(v, 10, 32); err == nil {
+		return int2ip(uint32(i)), nil
+	}
+	ip := net.ParseIP(v)
+	if ip == nil {
+		return nil, fmt.Errorf("Error parsing '%s': '%s' is neither an IP address nor an integer", name, v)
+	}
+	return ip, nil
+}
+
+func (r *jsonlRow) Value(column string) (string, bool) {
+	if r.decode() != nil {
+		return "", false
+	}
+
+	var v interface{} = r.values
+	for path, ok := column, true; ok; {
+		var name string
+		name, path, ok = strings.Cut(path, ".")
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v = t[name]
+		case []interface{}:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(t) {
+				return "", false
+			}
+			v = t[i]
+		default:
+			return "", false
+		}
+	}
+
+	switch t := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return t, true
+	case json.Number:
+		return t.String(), true
+	case bool:
+		return strconv.FormatBool(t), true
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
@@ -0,0 +1,106 @@
+package convert
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestJSONLRowValue(t *testing.T) {
+	row := &jsonlRow{line: []byte(`{"asn": {"number": 3303, "name": "Swisscom"}, "tags": ["a", {"b": "c"}], "anycast": true, "empty": "", "none": null, "ratio": 1.50, "big": 18446744073709551615, "nested": {"x": [1, 2]}}` + "\n")}
+	tests := []struct {
+		column string
+		want   string
+		ok     bool
+	}{
+		{"asn.number", "3303", true},
+		{"asn.name", "Swisscom", true},
+		{"tags.0", "a", true},
+		{"tags.1.b", "c", true},
+		{"anycast", "true", true},
+		{"empty", "", true},
+		{"ratio", "1.50", true},
+		{"big", "18446744073709551615", true},
+		{"nested", `{"x":[1,2]}`, true},
+		{"nested.x", "[1,2]", true},
+		{"none", "", false},
+		{"none.x", "", false},
+		{"missing", "", false},
+		{"asn.missing", "", false},
+		{"asn.number.x", "", false},
+		{"tags.2", "", false},
+		{"tags.-1", "", false},
+		{"tags.x", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.column, func(t *testing.T) {
+			got, ok := row.Value(test.column)
+			if got != test.want || ok != test.ok {
+				t.Fatalf("got %q, %v, want %q, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestJSONLRowRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		start string
+		end   string
+		err   string
+	}{
+		{"network", `{"network": "10.1.0.0/16"}`, "10.1.0.0", "10.1.255.255", ""},
+		{"network not aligned", `{"network": "10.1.2.3/24"}`, "10.1.2.0", "10.1.2.255", ""},
+		{"single address", `{"network": "10.1.2.3/32"}`, "10.1.2.3", "10.1.2.3", ""},
+		{"addresses", `{"start_ip": "10.0.0.1", "end_ip": "10.0.0.9"}`, "10.0.0.1", "10.0.0.9", ""},
+		{"integers", `{"start_ip": 167772161, "end_ip": 167772169}`, "10.0.0.1", "10.0.0.9", ""},
+		{"integer strings", `{"start_ip": "167772161", "end_ip": "167772169"}`, "10.0.0.1", "10.0.0.9", ""},
+		{"network first", `{"network": "10.1.0.0/16", "start_ip": "10.0.0.1", "end_ip": "10.0.0.9"}`, "10.1.0.0", "10.1.255.255", ""},
+		{"null network", `{"network": null, "start_ip": "10.0.0.1", "end_ip": "10.0.0.9"}`, "10.0.0.1", "10.0.0.9", ""},
+		{"IPv6 network", `{"network": "2001:db8::/32"}`, "", "", "isn't an IPv4 network"},
+		{"invalid network", `{"network": "10.1.0.0"}`, "", "", "Error parsing network"},
+		{"missing end", `{"start_ip": "10.0.0.1"}`, "", "", "expecting either 'network', or 'start_ip' and 'end_ip'"},
+		{"invalid address", `{"start_ip": "10.0.0", "end_ip": "10.0.0.9"}`, "", "", "is neither an IP address nor an integer"},
+		{"integer out of range", `{"start_ip": 4294967296, "end_ip": 4294967296}`, "", "", "is neither an IP address nor an integer"},
+		{"not an object", `[1, 2]`, "", "", "Error decoding JSON object"},
+		{"null", `null`, "", "", "expecting an object"},
+		{"trailing data", `{"network": "10.1.0.0/16"} {}`, "", "", "trailing data"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end, err := (&jsonlRow{line: []byte(test.line)}).Range()
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %s-%s, error %v, want error %q", start, end, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !start.Equal(net.ParseIP(test.start)) || !end.Equal(net.ParseIP(test.end)) {
+				t.Fatalf("got %s-%s, want %s-%s", start, end, test.start, test.end)
+			}
+		})
+	}
+}
+
+func TestJSONLSource(t *testing.T) {
+	s := NewJSONLSource(strings.NewReader("{\"network\": \"10.0.0.0/8\", \"a\": 1}\n\n  \n{\"network\": \"11.0.0.0/8\", \"a\": 2}"))
+	var values []string
+	for {
+		row, err := s.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		v, _ := row.Value("a")
+		values = append(values, v)
+	}
+	if strings.Join(values, ",") != "1,2" {
+		t.Fatalf("got values %q, want 1 and 2", values)
+	}
+}
@@ -0,0 +1,157 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// batchSize is the number of rows passed between the stages of the
+// conversion pipeline at once.
+const batchSize = 1024
+
+// maxBatchesPerWorker is the number of batches per mapping goroutine which
+// may be read, but not yet inserted, at once.
+const maxBatchesPerWorker = 4
+
+// rowBatch holds consecutive input rows. Batches are numbered consecutively
+// by `seq`, so they can be put back in order after being mapped.
+type rowBatch struct {
+	seq int
+	// firstRow is the row number of the first row in the batch
+	firstRow int
+	rows     []Row
+	// err is the error which occurred reading the row following the
+	// batch's rows
+	err error
+}
+
+// mappedRecord is an mmdb record, along with the IP range it applies to.
+type mappedRecord struct {
+	start net.IP
+	end   net.IP
+	data  mmdbRow
+}
+
+// recordBatch holds the records mapped from the rowBatch with the same
+// `seq`. Rows that were omitted don't have a record.
+type recordBatch struct {
+	seq     int
+	records []*mappedRecord
+	// rows is the number of rows read, whether they were mapped or not
+	rows int
+	// skipped counts the rows omitted per SkipReason*
+	skipped map[string]uint64
+	// err is the error which occurred reading or mapping the row following
+	// the batch's records
+	err error
+}
+
+// readRows reads rows from `source` and sends them to `batches` until the
+// end of the input is reached, an error occurs, or `ctx` is done. Before
+// sending a batch, it acquires one of the `slots`, which is released once the
+// batch's records have been inserted. This limits the number of batches held
+// in memory, as mapped batches may have to wait for earlier ones.
+func readRows(ctx context.Context, source RowSource, batches chan<- *rowBatch, slots chan<- struct{}) {
+	defer close(batches)
+
+	row := 0
+	for seq := 0; ; seq++ {
+		b := &rowBatch{seq: seq, firstRow: row + 1}
+		eof := false
+		for len(b.rows) < batchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			data, err := source.Next()
+			if err == io.EOF {
+				eof = true
+				break
+			} else if err != nil {
+				b.err = err
+				break
+			}
+			row++
+			b.rows = append(b.rows, data)
+		}
+
+		if len(b.rows) > 0 || b.err != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case batches <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if eof || b.err != nil {
+			return
+		}
+	}
+}
+
+// mapRows maps the rows received from `batches` and sends the resulting
+// records to `results`, until `batches` is closed or `ctx` is done.
+func mapRows(ctx context.Context, rowMapper *RowMapper, batches <-chan *rowBatch, results chan<- *recordBatch) {
+	for b := range batches {
+		res := &recordBatch{seq: b.seq, rows: len(b.rows), skipped: map[string]uint64{}, err: b.err}
+		for i, data := range b.rows {
+			if ctx.Err() != nil {
+				return
+			}
+			row := b.firstRow + i
+			r, reason, err := mapRecord(rowMapper, row, data)
+			if err != nil {
+				res.err = errors.Wrapf(err, "error writing output record (at input row %d)", row)
+				break
+			}
+			if r != nil {
+				res.records = append(res.records, r)
+			} else {
+				res.skipped[reason]++
+			}
+		}
+
+		select {
+		case results <- res:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// mapRecord maps the input row `data`, with row number `row`. It returns nil
+// and the reason if the row is to be omitted.
+func mapRecord(rowMapper *RowMapper, row int, data Row) (*mappedRecord, string, error) {
+	start, end, err := data.Range()
+	if err != nil {
+		return nil, "", err
+	}
+	if start.To4() == nil || end.To4() == nil {
+		return nil, "", fmt.Errorf("range %s-%s isn't an IPv4 range", start, end)
+	}
+	if bytes.Compare(start.To4(), end.To4()) > 0 {
+		return nil, "", fmt.Errorf("range %s-%s starts after it ends", start, end)
+	}
+
+	r, reason, err := rowMapper.mapRow(row, data)
+	if err != nil {
+		return nil, "", err
+	}
+	if r == nil {
+		return nil, reason, nil
+	}
+
+	return &mappedRecord{
+		start: start,
+		end:   end,
+		data:  r,
+	}, "", nil
+}
@@ -0,0 +1,91 @@
+package convert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FieldMapperFactory creates the FieldMapper for a field configuration. It
+// may return an error if the configuration isn't valid for the field type,
+// e.g. if FieldConfig.DecodeOptions fails. Factories are called during
+// config validation as well as during conversion, so they must not have side
+// effects.
+type FieldMapperFactory func(*FieldConfig) (FieldMapper, error)
+
+var (
+	fieldMapperFactoriesMu sync.RWMutex
+	fieldMapperFactories   = map[string]FieldMapperFactory{}
+	// builtinFieldMapperTypes holds the names of the built-in types
+	builtinFieldMapperTypes = map[string]bool{}
+)
+
+func init() {
+	registerBuiltinFieldMapper("string", newStringFieldMapper)
+	registerBuiltinFieldMapper("int32", newInt32FieldMapper)
+	registerBuiltinFieldMapper("uint16", newUint16FieldMapper)
+	registerBuiltinFieldMapper("uint32", newUint32FieldMapper)
+	registerBuiltinFieldMapper("uint64", newUint64FieldMapper)
+	registerBuiltinFieldMapper("uint128", NewUint128FieldMapper)
+	registerBuiltinFieldMapper("boolean", newBooleanFieldMapper)
+	registerBuiltinFieldMapper("float32", newFloat32FieldMapper)
+	registerBuiltinFieldMapper("float64", newFloat64FieldMapper)
+	registerBuiltinFieldMapper("bytes", NewBytesFieldMapper)
+	registerBuiltinFieldMapper("json", NewJSONFieldMapper)
+	registerBuiltinFieldMapper("timestamp", NewTimestampFieldMapper)
+}
+
+func registerBuiltinFieldMapper[T FieldMapper](typeName string, newMapper func(*FieldConfig) (T, error)) {
+	builtinFieldMapperTypes[typeName] = true
+	RegisterFieldMapper(typeName, func(fc *FieldConfig) (FieldMapper, error) {
+		m, err := newMapper(fc)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	})
+}
+
+// RegisterFieldMapper makes a field type available by the provided name,
+// so it can be used as `type` in field configurations. If RegisterFieldMapper
+// is called twice with the same name, or if factory is nil, it panics.
+func RegisterFieldMapper(typeName string, factory FieldMapperFactory) {
+	fieldMapperFactoriesMu.Lock()
+	defer fieldMapperFactoriesMu.Unlock()
+
+	if factory == nil {
+		panic("convert: RegisterFieldMapper factory is nil")
+	}
+	if _, dup := fieldMapperFactories[typeName]; dup {
+		panic("convert: RegisterFieldMapper called twice for type " + typeName)
+	}
+	fieldMapperFactories[typeName] = factory
+}
+
+// FieldMapperTypes returns a sorted list of the names of all registered
+// field types.
+func FieldMapperTypes() []string {
+	fieldMapperFactoriesMu.RLock()
+	defer fieldMapperFactoriesMu.RUnlock()
+
+	types := make([]string, 0, len(fieldMapperFactories))
+	for t := range fieldMapperFactories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewFieldMapper creates the FieldMapper for the field's type, using the
+// factory registered for that type.
+func NewFieldMapper(f *FieldConfig) (FieldMapper, error) {
+	fieldMapperFactoriesMu.RLock()
+	factory, ok := fieldMapperFactories[f.Type]
+	fieldMapperFactoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown field type '%s' for field '%s', supported types are: %s", f.Type, f.Name, strings.Join(FieldMapperTypes(), ", "))
+	}
+	return factory(f)
+}
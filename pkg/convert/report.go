@@ -0,0 +1,126 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+)
+
+const (
+	// MissKindTranslation indicates that no translation existed for a value.
+	MissKindTranslation = "translation"
+	// MissKindInvalid indicates that a value couldn't be converted to the
+	// field's type.
+	MissKindInvalid = "invalid"
+	// MissKindConstraint indicates that a value violated one of the field's
+	// constraints.
+	MissKindConstraint = "constraint"
+)
+
+// maxMissExamples is the number of example rows kept per field and kind. The
+// examples kept are those with the lowest row numbers, so the report doesn't
+// depend on the order in which rows were mapped.
+const maxMissExamples = 5
+
+// MissReporter receives values a FieldMapper wasn't able to translate or
+// convert, but which didn't cause the conversion to be aborted.
+type MissReporter interface {
+	ReportMiss(fc *FieldConfig, kind string, value string)
+}
+
+type MissExample struct {
+	Row   int    `json:"row"`
+	Value string `json:"value"`
+}
+
+// FieldMisses aggregates the misses of one kind for a single field.
+type FieldMisses struct {
+	Field    string         `json:"field"`
+	Target   string         `json:"target"`
+	Kind     string         `json:"kind"`
+	Count    uint64         `json:"count"`
+	Examples []*MissExample `json:"examples"`
+}
+
+type missKey struct {
+	field  string
+	target string
+	kind   string
+}
+
+// MissReport collects misses per field during conversion, so they can be
+// reviewed once the conversion is done. It is safe for concurrent use.
+type MissReport struct {
+	mu     sync.Mutex
+	index  map[missKey]*FieldMisses
+	Fields []*FieldMisses `json:"fields"`
+}
+
+func NewMissReport() *MissReport {
+	return &MissReport{
+		index:  map[missKey]*FieldMisses{},
+		Fields: []*FieldMisses{},
+	}
+}
+
+// Add records a miss of `kind` for field `fc` at input row `row`.
+func (r *MissReport) Add(fc *FieldConfig, kind string, value string, row int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := missKey{field: fc.Name, target: fc.Target, kind: kind}
+	fm, ok := r.index[key]
+	if !ok {
+		fm = &FieldMisses{
+			Field:  fc.Name,
+			Target: fc.Target,
+			Kind:   kind,
+		}
+		r.index[key] = fm
+		r.Fields = append(r.Fields, fm)
+	}
+
+	fm.Count++
+	i := sort.Search(len(fm.Examples), func(i int) bool { return fm.Examples[i].Row > row })
+	if i >= maxMissExamples {
+		return
+	}
+	if len(fm.Examples) < maxMissExamples {
+		fm.Examples = append(fm.Examples, nil)
+	}
+	copy(fm.Examples[i+1:], fm.Examples[i:])
+	fm.Examples[i] = &MissExample{Row: row, Value: value}
+}
+
+func (r *MissReport) Empty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.Fields) == 0
+}
+
+// WriteTable writes a human readable summary of the report to `w`.
+func (r *MissReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tTARGET\tKIND\tCOUNT\tEXAMPLES")
+	for _, fm := range r.Fields {
+		examples := ""
+		for i, e := range fm.Examples {
+			if i > 0 {
+				examples += ", "
+			}
+			examples += fmt.Sprintf("row %d: '%s'", e.Row, e.Value)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", fm.Field, fm.Target, fm.Kind, fm.Count, examples)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the report to `w` in JSON format.
+func (r *MissReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/fholzer/csv2mmdb/pkg/convert/internal/valuecache"
 	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/pkg/errors"
 )
 
 type (
@@ -12,56 +14,104 @@ type (
 	MapFunc func([]string) mmdbRow
 )
 
+// RowMapper maps input rows to mmdb records. A RowMapper is not safe for
+// concurrent use, as field mappers keep state while mapping a value. To map
+// rows concurrently, create one RowMapper per goroutine using
+// NewMapperWithReport or NewSourceMapper, sharing a single MissReport.
 type RowMapper struct {
-	config                   *Config
-	fieldConfigMapping       map[string]FieldMapper
-	targetFields             map[string]*FieldConfig
-	sourceFieldNames         []string
+	config *Config
+	// fieldMappers holds the field mappers in the order of the fields in the
+	// config
+	fieldMappers     []FieldMapper
+	targetFields     map[string]*FieldConfig
+	sourceFieldNames []string
+	// sourceFieldHeaderOffsets maps column names to their index in rows
+	// passed to Map
 	sourceFieldHeaderOffsets map[string]int
 	stringCache              map[string]mmdbtype.String
+	missReport               *MissReport
+	// interner, if set, deduplicates string values
+	interner *valuecache.Interner
+	// row is the number of the input row currently being mapped
+	row int
+	// values holds the source values of the row currently being mapped, per
+	// field mapper
+	values []string
+	// misses holds the misses of the row currently being mapped, which are
+	// added to the report once it's known whether the row is omitted
+	misses []pendingMiss
+}
+
+type pendingMiss struct {
+	fc    *FieldConfig
+	kind  string
+	value string
 }
 
 func NewMapper(config *Config, header []string) (*RowMapper, error) {
-	if header[0] != STR_START_IP || header[1] != STR_END_IP {
-		return nil, fmt.Errorf("expecting '%s' and '%s' to be the first two column headers. Found '%s' and '%s'", STR_START_IP, STR_END_IP, header[0], header[1])
+	return NewMapperWithReport(config, header, NewMissReport())
+}
+
+// NewMapperWithReport creates a RowMapper for CSV rows with the header
+// `header`, which records misses in `report`.
+func NewMapperWithReport(config *Config, header []string, report *MissReport) (*RowMapper, error) {
+	if err := checkRangeColumns(header); err != nil {
+		return nil, err
+	}
+
+	m, err := NewSourceMapper(config, header, report)
+	if err != nil {
+		return nil, err
+	}
+	m.sourceFieldHeaderOffsets = columnOffsets(header)
+	return m, nil
+}
+
+// NewSourceMapper creates a RowMapper for rows of a RowSource with the
+// columns `columns`, which records misses in `report`. If `columns` is nil,
+// the columns of fields aren't checked.
+func NewSourceMapper(config *Config, columns []string, report *MissReport) (*RowMapper, error) {
+	hasColumn := func(name string) bool {
+		if columns == nil {
+			return true
+		}
+		for _, v := range columns {
+			if v == name {
+				return true
+			}
+		}
+		return false
 	}
 
-	sourceFieldHeaderOffsets := map[string]int{}
 	var sourceFieldNames []string
+	var fieldMappers []FieldMapper
 	fieldConfigMapping := map[string]FieldMapper{}
 	// stored the first FieldConfig that causes that object to be created
 	targetFields := map[string]*FieldConfig{}
-	targetToSourceOffsetMapping := map[string]int{}
 	stringCache := map[string]mmdbtype.String{}
 
 	for _, fieldConfig := range config.Fields {
 		sourceFieldNames = append(sourceFieldNames, fieldConfig.Name)
 		ft := fieldConfig.Target
 
-		// find field's header offset
-		foundHeader := false
-		for i, v := range header {
-			if v == fieldConfig.Name {
-				sourceFieldHeaderOffsets[fieldConfig.Name] = i
-				targetToSourceOffsetMapping[fieldConfig.Target] = i
-				foundHeader = true
-				break
-			}
-		}
-		if !foundHeader {
+		if !hasColumn(fieldConfig.Name) && fieldConfig.Default == nil && fieldConfig.Fallback == "" {
 			return nil, fmt.Errorf("field '%s' for target '%s' not found in input file", fieldConfig.Name, fieldConfig.Target)
 		}
+		if fieldConfig.Fallback != "" && !hasColumn(fieldConfig.Fallback) {
+			return nil, fmt.Errorf("fallback field '%s' of field '%s' not found in input file", fieldConfig.Fallback, fieldConfig.Name)
+		}
 
 		// check for duplicate targets
 		if prevField, ok := fieldConfigMapping[ft]; ok {
 			return nil, fmt.Errorf("duplicate target fields, field '%s' and '%s', both target '%s'", prevField.GetConfig().Name, fieldConfig.Name, ft)
 		}
 
-		var err error
-		fieldConfigMapping[ft], err = NewFieldMapper(fieldConfig)
+		fm, err := NewFieldMapper(fieldConfig)
 		if err != nil {
 			return nil, err
 		}
+		fieldConfigMapping[ft] = fm
+		fieldMappers = append(fieldMappers, fm)
 
 		// extract objects names from field paths and populate targetFields
 		fieldComponents := strings.Split(fieldConfig.Target, ".")
@@ -76,45 +126,125 @@ func NewMapper(config *Config, header []string) (*RowMapper, error) {
 	}
 
 	// check for conflicts between object and value targets
-	for fn, fc := range fieldConfigMapping {
-		if objOriginConfig, ok := targetFields[fn]; ok && fc.GetConfig() != objOriginConfig {
+	for _, fc := range fieldMappers {
+		if objOriginConfig, ok := targetFields[fc.GetConfig().Target]; ok && fc.GetConfig() != objOriginConfig {
 			return nil, fmt.Errorf("target '%s' of field '%s' conflicts with object created by target of field '%s'", fc.GetConfig().Target, fc.GetConfig().Name, objOriginConfig.Name)
 		}
 	}
 
-	return &RowMapper{
-		config:                   config,
-		fieldConfigMapping:       fieldConfigMapping,
-		sourceFieldNames:         sourceFieldNames,
-		targetFields:             targetFields,
-		sourceFieldHeaderOffsets: sourceFieldHeaderOffsets,
-		stringCache:              stringCache,
-	}, nil
+	m := &RowMapper{
+		config:           config,
+		fieldMappers:     fieldMappers,
+		sourceFieldNames: sourceFieldNames,
+		targetFields:     targetFields,
+		stringCache:      stringCache,
+		missReport:       report,
+		values:           make([]string, len(fieldMappers)),
+	}
+	for _, fm := range fieldMappers {
+		fm.SetMissReporter(m)
+	}
+	return m, nil
+}
+
+// ReportMiss records a miss for the row currently being mapped. Misses are
+// added to the report once the row has been mapped, see mapRow.
+func (m *RowMapper) ReportMiss(fc *FieldConfig, kind string, value string) {
+	m.misses = append(m.misses, pendingMiss{fc: fc, kind: kind, value: value})
+}
+
+// addMisses adds the misses recorded for the current row, starting with the
+// one at index `from`, to the report.
+func (m *RowMapper) addMisses(from int) {
+	for _, miss := range m.misses[from:] {
+		m.missReport.Add(miss.fc, miss.kind, miss.value, m.row)
+	}
+	m.misses = m.misses[:0]
 }
 
+// MissReport returns the misses collected while mapping rows.
+func (m *RowMapper) MissReport() *MissReport {
+	return m.missReport
+}
+
+// Map maps the CSV row `data` to an mmdb record. It returns nil if the row is
+// to be omitted. Rows are numbered in the order they are mapped, which is
+// the row number reported along with misses. The RowMapper must have been
+// created by NewMapper or NewMapperWithReport.
 func (m *RowMapper) Map(data []string) (mmdbRow, error) {
-	r := mmdbRow{}
+	return m.MapWithRow(m.row+1, data)
+}
 
-	for _, fieldConfig := range m.fieldConfigMapping {
-		// prepare value
-		val := data[m.sourceFieldHeaderOffsets[fieldConfig.GetConfig().Name]]
+// MapWithRow is like Map, but takes the row number `row` of `data`, e.g. if
+// rows are mapped concurrently, or not all rows are mapped.
+func (m *RowMapper) MapWithRow(row int, data []string) (mmdbRow, error) {
+	return m.MapRow(row, &csvRow{offsets: m.sourceFieldHeaderOffsets, values: data})
+}
 
-		if fieldConfig.ShouldOmitRecord(val) {
-			return nil, nil
+// MapRow maps the input row `data`, with row number `row`, to an mmdb
+// record. It returns nil if the row is to be omitted.
+func (m *RowMapper) MapRow(row int, data Row) (mmdbRow, error) {
+	r, _, err := m.mapRow(row, data)
+	return r, err
+}
+
+// mapRow is like MapRow, but returns the reason a row was omitted as well,
+// as one of the SkipReason* constants.
+//
+// Fields are mapped in the order of the config, after all of them were
+// checked for missing critical values. The misses of a row are only
+// reported if the row is kept. If the row is omitted because of a field's
+// value, only that value is reported.
+func (m *RowMapper) mapRow(row int, data Row) (mmdbRow, string, error) {
+	m.row = row
+	m.misses = m.misses[:0]
+
+	for i, fieldConfig := range m.fieldMappers {
+		m.values[i] = m.getSourceValue(data, fieldConfig.GetConfig())
+		if fieldConfig.ShouldOmitRecord(m.values[i]) {
+			return nil, SkipReasonCritical, nil
 		}
+	}
 
+	r := mmdbRow{}
+	for i, fieldConfig := range m.fieldMappers {
+		val := m.values[i]
 		if fieldConfig.ShouldOmitValue(val) {
 			continue
 		}
 
+		misses := len(m.misses)
 		mmdbVal, err := fieldConfig.Map(val)
-		if err != nil {
-			return nil, err
+		if err == ErrOmitRecord {
+			m.addMisses(misses)
+			return nil, SkipReasonOmitRecord, nil
+		} else if err == ErrOmitValue {
+			continue
+		} else if err != nil {
+			kind, reason := MissKindInvalid, SkipReasonInvalid
+			var constraintErr *ConstraintError
+			if errors.As(err, &constraintErr) {
+				kind, reason = MissKindConstraint, SkipReasonConstraint
+			}
+
+			switch fieldConfig.GetConfig().InvalidMode {
+			case InvalidModeOmitValue:
+				m.ReportMiss(fieldConfig.GetConfig(), kind, val)
+				continue
+			case InvalidModeOmitRecord:
+				m.ReportMiss(fieldConfig.GetConfig(), kind, val)
+				m.addMisses(misses)
+				return nil, reason, nil
+			}
+			return nil, "", err
 		}
 
 		if mmdbVal == nil {
 			continue
 		}
+		if s, ok := mmdbVal.(mmdbtype.String); ok && m.interner != nil {
+			mmdbVal = m.interner.String(s)
+		}
 
 		// prepare location at which to store value
 		components := fieldConfig.GetTargetFieldComponents()
@@ -124,14 +254,30 @@ func (m *RowMapper) Map(data []string) (mmdbRow, error) {
 			var err error
 			loc, err = m.getMapByComponents(loc, pathComponents)
 			if err != nil {
-				return nil, err
+				return nil, "", err
 			}
 		}
 
 		loc[mmdbtype.String(components[len(components)-1])] = mmdbVal
 	}
 
-	return r, nil
+	m.addMisses(0)
+	return r, "", nil
+}
+
+// getSourceValue returns the value of the field's source column. In case the
+// column is empty or not present in the input file, the value of the
+// fallback column is returned, if one is configured. If that's empty as
+// well, the field's default value is returned, if one is configured.
+func (m *RowMapper) getSourceValue(data Row, fc *FieldConfig) string {
+	val, _ := data.Value(fc.Name)
+	if val == "" && fc.Fallback != "" {
+		val, _ = data.Value(fc.Fallback)
+	}
+	if val == "" && fc.Default != nil {
+		return *fc.Default
+	}
+	return val
 }
 
 func (m *RowMapper) getCachedString(s string) mmdbtype.String {
@@ -0,0 +1,105 @@
+package convert
+
+import (
+	"testing"
+)
+
+func TestMapRowMisses(t *testing.T) {
+	config, err := testNewConfig(t, `
+fields:
+  - name: name
+    target: name
+    translate:
+      austria: Austria
+    translateMode: omitValue
+  - name: asn
+    target: asn
+    type: uint32
+    invalidMode: omitValue
+  - name: code
+    target: code
+    critical: true
+  - name: population
+    target: population
+    type: uint32
+  - name: area
+    target: area
+    type: uint32
+    invalidMode: omitRecord
+`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		values map[string]string
+		reason string
+		misses map[string]uint64
+	}{
+		{
+			name:   "critical",
+			values: map[string]string{"name": "germany", "asn": "x", "code": "", "population": "x", "area": "x"},
+			reason: SkipReasonCritical,
+		},
+		{
+			name:   "kept",
+			values: map[string]string{"name": "germany", "asn": "x", "code": "at", "population": "1", "area": "1"},
+			misses: map[string]uint64{"name/translation": 1, "asn/invalid": 1},
+		},
+		{
+			name:   "omitRecord",
+			values: map[string]string{"name": "germany", "asn": "x", "code": "at", "population": "1", "area": "x"},
+			reason: SkipReasonInvalid,
+			misses: map[string]uint64{"area/invalid": 1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the outcome mustn't depend on the order fields are mapped in
+			for i := 0; i < 20; i++ {
+				report := NewMissReport()
+				m, err := NewSourceMapper(config, nil, report)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r, reason, err := m.mapRow(1, &MemoryRow{Values: test.values})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if reason != test.reason || (r == nil) != (reason != "") {
+					t.Fatalf("got record %v, reason %q, want reason %q", r, reason, test.reason)
+				}
+
+				misses := map[string]uint64{}
+				for _, f := range report.Fields {
+					misses[f.Field+"/"+f.Kind] = f.Count
+				}
+				if len(misses) != len(test.misses) {
+					t.Fatalf("got misses %v, want %v", misses, test.misses)
+				}
+				for k, n := range test.misses {
+					if misses[k] != n {
+						t.Fatalf("got misses %v, want %v", misses, test.misses)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewMapperHeader(t *testing.T) {
+	config, err := testNewConfig(t, "fields:\n  - name: f\n    target: f\n", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := make([]string, 1, 3)
+	header[0] = "f"
+	if _, err := NewMapper(config, header); err == nil {
+		t.Fatal("header without range columns was accepted")
+	}
+	if header[:3][1] != "" || header[:3][2] != "" {
+		t.Fatalf("header was modified: %q", header[:3])
+	}
+}
@@ -0,0 +1,171 @@
+package convert
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// RowSource provides the input rows of a conversion. Next is only called by
+// a single goroutine, but the rows returned are mapped concurrently, so they
+// must remain valid, and not be modified, once returned.
+type RowSource interface {
+	// Columns returns the names of the columns of the input, which is used
+	// to check that the columns of all fields exist. If it returns nil, the
+	// check is skipped, and columns missing in a row are treated as empty.
+	Columns() ([]string, error)
+	// Next returns the next row, or io.EOF if there are no more rows.
+	Next() (Row, error)
+}
+
+// Row is an input row.
+type Row interface {
+	// Range returns the first and the last IP address of the range the row
+	// applies to.
+	Range() (start net.IP, end net.IP, err error)
+	// Value returns the value of the column `column`, and whether the row has
+	// that column.
+	Value(column string) (string, bool)
+}
+
+// MemoryRow is a Row whose values are held by a map, e.g. for rows which are
+// already in memory.
+type MemoryRow struct {
+	Start  net.IP
+	End    net.IP
+	Values map[string]string
+}
+
+func (r *MemoryRow) Range() (net.IP, net.IP, error) {
+	return r.Start, r.End, nil
+}
+
+func (r *MemoryRow) Value(column string) (string, bool) {
+	v, ok := r.Values[column]
+	return v, ok
+}
+
+// sliceSource is a RowSource returning the rows of a slice.
+type sliceSource struct {
+	columns []string
+	rows    []Row
+}
+
+// NewSliceSource returns a RowSource returning `rows`, which have the columns
+// `columns`. If `columns` is nil, the columns of fields aren't checked.
+func NewSliceSource(columns []string, rows []Row) RowSource {
+	return &sliceSource{columns: columns, rows: rows}
+}
+
+func (s *sliceSource) Columns() ([]string, error) {
+	return s.columns, nil
+}
+
+func (s *sliceSource) Next() (Row, error) {
+	if len(s.rows) == 0 {
+		return nil, io.EOF
+	}
+	r := s.rows[0]
+	s.rows = s.rows[1:]
+	return r, nil
+}
+
+// CSVSource is a RowSource reading CSV. The first row is the header, whose
+// first two columns must be STR_START_IP and STR_END_IP, holding the range
+// as integers.
+type CSVSource struct {
+	reader *csv.Reader
+	header []string
+	// offsets maps column names to their index, and is shared by all rows
+	offsets map[string]int
+}
+
+func NewCSVSource(input io.Reader) *CSVSource {
+	return &CSVSource{reader: csv.NewReader(input)}
+}
+
+func (s *CSVSource) Columns() ([]string, error) {
+	if s.header != nil {
+		return s.header, nil
+	}
+
+	header, err := s.reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading CSV header")
+	}
+	if err := checkRangeColumns(header); err != nil {
+		return nil, err
+	}
+
+	s.header = header
+	s.offsets = columnOffsets(header)
+	return header, nil
+}
+
+// checkRangeColumns checks that the CSV header `header` starts with the
+// columns of the range.
+func checkRangeColumns(header []string) error {
+	if len(header) >= 2 && header[0] == STR_START_IP && header[1] == STR_END_IP {
+		return nil
+	}
+	var found [2]string
+	copy(found[:], header)
+	return fmt.Errorf("expecting '%s' and '%s' to be the first two column headers. Found '%s' and '%s'", STR_START_IP, STR_END_IP, found[0], found[1])
+}
+
+func (s *CSVSource) Next() (Row, error) {
+	if _, err := s.Columns(); err != nil {
+		return nil, err
+	}
+	values, err := s.reader.Read()
+	if err == io.EOF {
+		return nil, err
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error reading CSV")
+	}
+	return &csvRow{offsets: s.offsets, values: values}, nil
+}
+
+// columnOffsets maps the column names of `header` to their index. If a name
+// occurs more than once, the first column is used.
+func columnOffsets(header []string) map[string]int {
+	offsets := make(map[string]int, len(header))
+	for i, name := range header {
+		if _, ok := offsets[name]; !ok {
+			offsets[name] = i
+		}
+	}
+	return offsets
+}
+
+// csvRow is a row read by CSVSource.
+type csvRow struct {
+	offsets map[string]int
+	values  []string
+}
+
+func (r *csvRow) Range() (net.IP, net.IP, error) {
+	iStart, err := strconv.ParseUint(r.values[0], 10, 32)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Error converting start IP to int: %s\n", r.values[0])
+	}
+
+	iEnd, err := strconv.ParseUint(r.values[1], 10, 32)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Error converting end IP to int: %s\n", r.values[1])
+	}
+
+	return int2ip(uint32(iStart)), int2ip(uint32(iEnd)), nil
+}
+
+func (r *csvRow) Value(column string) (string, bool) {
+	i, ok := r.offsets[column]
+	if !ok || i >= len(r.values) {
+		return "", false
+	}
+	return r.values[i], true
+}
@@ -0,0 +1,243 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/metrics"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SkipReasonCritical indicates that a row was omitted, because one of
+	// its critical fields was empty.
+	SkipReasonCritical = "critical"
+	// SkipReasonOmitRecord indicates that a row was omitted, because a field
+	// mapper requested it, e.g. for a translate mode of omitRecord.
+	SkipReasonOmitRecord = "omitRecord"
+	// SkipReasonInvalid indicates that a row was omitted, because one of its
+	// values couldn't be converted, and the field's invalid mode is
+	// omitRecord.
+	SkipReasonInvalid = "invalid"
+	// SkipReasonConstraint indicates that a row was omitted, because one of
+	// its values violated a constraint, and the field's invalid mode is
+	// omitRecord.
+	SkipReasonConstraint = "constraint"
+)
+
+const (
+	PhaseMap   = "map"
+	PhaseMerge = "merge"
+	PhaseWrite = "write"
+)
+
+// ConversionStats describes a conversion. If the conversion failed, the
+// stats cover the part of the conversion that was completed.
+type ConversionStats struct {
+	// RowsRead is the number of input rows read, excluding the header.
+	RowsRead uint64 `json:"rowsRead"`
+	// RowsInserted is the number of rows inserted into the tree, or, in
+	// bounded-memory mode, passed on to be merged.
+	RowsInserted uint64 `json:"rowsInserted"`
+	// RowsSkipped is the number of rows omitted, per SkipReason*.
+	RowsSkipped map[string]uint64 `json:"rowsSkipped"`
+	// RowsMerged is the number of ranges joined with the preceding adjacent
+	// range, as they had the same record. Ranges are only joined in
+	// bounded-memory mode.
+	RowsMerged uint64 `json:"rowsMerged"`
+	// UniqueRecords is the number of distinct records. It is only
+	// determined if the value cache or the bounded-memory mode is enabled.
+	UniqueRecords uint64 `json:"uniqueRecords"`
+	// NodeCount is the number of nodes of the search tree written.
+	NodeCount uint64 `json:"nodeCount"`
+	// OutputBytes is the size of the database written.
+	OutputBytes int64 `json:"outputBytes"`
+	// Phases lists the phases of the conversion completed, along with their
+	// durations.
+	Phases []*PhaseStats `json:"phases"`
+	// PeakHeapBytes is the peak size of the heap observed during the
+	// conversion. The heap is sampled periodically, so short peaks may be
+	// missed.
+	PeakHeapBytes uint64 `json:"peakHeapBytes"`
+	// Misses holds the values that couldn't be translated or converted.
+	Misses *MissReport `json:"-"`
+}
+
+type PhaseStats struct {
+	Name     string   `json:"name"`
+	Duration Duration `json:"duration"`
+}
+
+// Duration is a time.Duration, which is formatted as string, e.g. "1.5s",
+// in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func newConversionStats() *ConversionStats {
+	return &ConversionStats{
+		RowsSkipped: map[string]uint64{},
+		Phases:      []*PhaseStats{},
+		Misses:      NewMissReport(),
+	}
+}
+
+// addPhase records the completion of the phase `name`, which started at
+// `start`.
+func (s *ConversionStats) addPhase(name string, start time.Time) {
+	s.Phases = append(s.Phases, &PhaseStats{Name: name, Duration: Duration(time.Since(start))})
+}
+
+// WriteText writes the stats to `w` in human readable format.
+func (s *ConversionStats) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Rows read:\t%d\n", s.RowsRead)
+	fmt.Fprintf(tw, "Rows inserted:\t%d\n", s.RowsInserted)
+	reasons := make([]string, 0, len(s.RowsSkipped))
+	for reason := range s.RowsSkipped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(tw, "Rows skipped (%s):\t%d\n", reason, s.RowsSkipped[reason])
+	}
+	fmt.Fprintf(tw, "Rows merged:\t%d\n", s.RowsMerged)
+	fmt.Fprintf(tw, "Unique records:\t%d\n", s.UniqueRecords)
+	fmt.Fprintf(tw, "Tree nodes:\t%d\n", s.NodeCount)
+	fmt.Fprintf(tw, "Output size:\t%d bytes\n", s.OutputBytes)
+	for _, p := range s.Phases {
+		fmt.Fprintf(tw, "Duration (%s):\t%v\n", p.Name, time.Duration(p.Duration).Round(time.Millisecond))
+	}
+	fmt.Fprintf(tw, "Peak heap:\t%d MiB\n", s.PeakHeapBytes/1024/1024)
+	return tw.Flush()
+}
+
+// WriteJSON writes the stats to `w` in JSON format.
+func (s *ConversionStats) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// heapSamplingInterval is the interval at which the heap size is sampled.
+const heapSamplingInterval = 100 * time.Millisecond
+
+// heapSampler tracks the peak heap size, sampling it periodically until
+// stopped. Unlike runtime.ReadMemStats, this doesn't stop the world.
+type heapSampler struct {
+	sample []metrics.Sample
+	peak   uint64
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func startHeapSampler() *heapSampler {
+	h := &heapSampler{
+		sample: []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}},
+		stop:   make(chan struct{}),
+	}
+	h.read()
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		ticker := time.NewTicker(heapSamplingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.read()
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+	return h
+}
+
+func (h *heapSampler) read() {
+	metrics.Read(h.sample)
+	if h.sample[0].Value.Kind() == metrics.KindUint64 && h.sample[0].Value.Uint64() > h.peak {
+		h.peak = h.sample[0].Value.Uint64()
+	}
+}
+
+// Stop stops sampling and returns the peak heap size observed.
+func (h *heapSampler) Stop() uint64 {
+	close(h.stop)
+	h.wg.Wait()
+	h.read()
+	return h.peak
+}
+
+// maxTailSize is the number of trailing bytes of the output kept by
+// outputCounter, which has to be enough to hold the database's metadata.
+const maxTailSize = 64 * 1024
+
+// outputCounter counts the bytes written to the underlying writer, and
+// keeps the trailing bytes, so the metadata can be inspected once the
+// database was written. Writes fail once `ctx` is done.
+type outputCounter struct {
+	ctx  context.Context
+	w    io.Writer
+	n    int64
+	tail []byte
+}
+
+func (c *outputCounter) Write(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, errors.Wrap(err, "conversion cancelled")
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.tail = append(c.tail, p[:n]...)
+	if len(c.tail) > 2*maxTailSize {
+		c.tail = append(c.tail[:0], c.tail[len(c.tail)-maxTailSize:]...)
+	}
+	return n, err
+}
+
+var (
+	metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+	// nodeCountKey is the metadata key "node_count", encoded as MaxMind DB
+	// UTF-8 string of length 10.
+	nodeCountKey = append([]byte{2<<5 | 10}, "node_count"...)
+)
+
+// NodeCount returns the node count from the metadata of the database
+// written.
+func (c *outputCounter) NodeCount() (uint64, bool) {
+	start := bytes.LastIndex(c.tail, metadataStartMarker)
+	if start < 0 {
+		return 0, false
+	}
+	metadata := c.tail[start+len(metadataStartMarker):]
+	i := bytes.Index(metadata, nodeCountKey)
+	if i < 0 {
+		return 0, false
+	}
+	value := metadata[i+len(nodeCountKey):]
+
+	// the value is a uint32, whose control byte holds the type and the
+	// number of bytes following it
+	if len(value) == 0 || value[0]>>5 != 6 {
+		return 0, false
+	}
+	size := int(value[0] & 0x1f)
+	if size > 4 || len(value) < 1+size {
+		return 0, false
+	}
+	var n uint64
+	for _, b := range value[1 : 1+size] {
+		n = n<<8 | uint64(b)
+	}
+	return n, true
+}
@@ -0,0 +1,159 @@
+package convert
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	TimestampOutputEpoch   = "epoch"
+	TimestampOutputISO8601 = "iso8601"
+)
+
+const (
+	// LayoutUnix parses source values given as seconds since the Unix epoch.
+	LayoutUnix = "unix"
+	// LayoutUnixMilli parses source values given as milliseconds since the
+	// Unix epoch.
+	LayoutUnixMilli = "unixMilli"
+)
+
+// namedLayouts maps the names of predefined layouts, which may be used
+// instead of Go layouts, to the corresponding Go layouts.
+var namedLayouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"DateTime":    "2006-01-02 15:04:05",
+	"DateOnly":    "2006-01-02",
+}
+
+// Layouts is a list of time layouts. In the config file it is either given
+// as a single layout, or as a list of layouts.
+type Layouts []string
+
+func (l *Layouts) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var layout string
+		if err := value.Decode(&layout); err != nil {
+			return err
+		}
+		*l = Layouts{layout}
+		return nil
+	}
+	return value.Decode((*[]string)(l))
+}
+
+// validateTimestamp checks the timestamp related options of the field.
+func (f *FieldConfig) validateTimestamp() error {
+	if f.TimestampOutput == "" && f.supportsTypeOption("timestampOutput") {
+		f.TimestampOutput = TimestampOutputEpoch
+	}
+	switch f.TimestampOutput {
+	case "":
+	case TimestampOutputEpoch:
+	case TimestampOutputISO8601:
+	default:
+		return fmt.Errorf("unknown timestamp output '%s' for field '%s'", f.TimestampOutput, f.Name)
+	}
+
+	if f.Timezone != "" {
+		if _, err := time.LoadLocation(f.Timezone); err != nil {
+			return errors.Wrapf(err, "invalid timezone for field '%s'", f.Name)
+		}
+	}
+	return nil
+}
+
+// TimestampFieldMapper parses date/time values using the field's layouts,
+// trying each layout in turn. Values are stored either as uint64 seconds
+// since the Unix epoch, or as ISO-8601 string in UTC.
+type TimestampFieldMapper struct {
+	BaseFieldMapper
+	layouts  []string
+	location *time.Location
+}
+
+func NewTimestampFieldMapper(fc *FieldConfig) (*TimestampFieldMapper, error) {
+	base, err := NewBaseFieldMapper(fc)
+	if err != nil {
+		return nil, err
+	}
+
+	layouts := append([]string{}, fc.Layout...)
+	if len(layouts) == 0 {
+		layouts = []string{time.RFC3339}
+	}
+	for i, l := range layouts {
+		if named, ok := namedLayouts[l]; ok {
+			layouts[i] = named
+		}
+	}
+
+	location := time.UTC
+	if fc.Timezone != "" {
+		if location, err = time.LoadLocation(fc.Timezone); err != nil {
+			return nil, errors.Wrapf(err, "invalid timezone for field '%s'", fc.Name)
+		}
+	}
+
+	return &TimestampFieldMapper{
+		BaseFieldMapper: *base,
+		layouts:         layouts,
+		location:        location,
+	}, nil
+}
+
+func (m *TimestampFieldMapper) Map(input string) (mmdbtype.DataType, error) {
+	return m.Process(input, m.Parse)
+}
+
+// Parse parses the value using the first matching layout. Values without
+// time zone information are interpreted in the field's timezone.
+func (m *TimestampFieldMapper) Parse(input string) (mmdbtype.DataType, error) {
+	t, err := m.parseTime(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.TimestampOutput == TimestampOutputISO8601 {
+		return mmdbtype.String(t.UTC().Format(time.RFC3339)), nil
+	}
+
+	if t.Unix() < 0 {
+		return nil, fmt.Errorf("Error converting field '%s' to timestamp: '%s' is before the Unix epoch", m.Name, input)
+	}
+	return mmdbtype.Uint64(t.Unix()), nil
+}
+
+func (m *TimestampFieldMapper) parseTime(input string) (time.Time, error) {
+	for _, layout := range m.layouts {
+		switch layout {
+		case LayoutUnix, LayoutUnixMilli:
+			f, err := strconv.ParseFloat(input, 64)
+			if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+				continue
+			}
+			if layout == LayoutUnixMilli {
+				f /= 1000
+			}
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(frac*1e9)), nil
+		default:
+			if t, err := time.ParseInLocation(layout, input, m.location); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("Error converting field '%s' to timestamp: '%s' doesn't match any of the layouts '%s'", m.Name, input, strings.Join(m.layouts, "', '"))
+}
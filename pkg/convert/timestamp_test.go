@@ -0,0 +1,53 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+func TestTimestampLayouts(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		input string
+		want  mmdbtype.DataType
+		err   string
+	}{
+		{"default RFC3339", "", "2024-03-01T12:00:00+01:00", mmdbtype.Uint64(1709290800), ""},
+		{"named layout", "layout: DateOnly", "2024-03-01", mmdbtype.Uint64(1709251200), ""},
+		{"Go layout", "layout: '02/01/2006 15:04'", "01/03/2024 12:00", mmdbtype.Uint64(1709294400), ""},
+		{"timezone", "layout: DateTime\ntimezone: Europe/Vienna", "2024-03-01 12:00:00", mmdbtype.Uint64(1709290800), ""},
+		{"zone of value before timezone", "timezone: Europe/Vienna", "2024-03-01T12:00:00Z", mmdbtype.Uint64(1709294400), ""},
+		{"unix", "layout: unix", "1709294400", mmdbtype.Uint64(1709294400), ""},
+		{"unix with fraction", "layout: unix", "1709294400.9", mmdbtype.Uint64(1709294400), ""},
+		{"unixMilli", "layout: unixMilli", "1709294400123", mmdbtype.Uint64(1709294400), ""},
+		{"first matching layout", "layout: [DateOnly, unix, RFC3339]", "1709294400", mmdbtype.Uint64(1709294400), ""},
+		{"later layout", "layout: [DateOnly, unix, RFC3339]", "2024-03-01T12:00:00Z", mmdbtype.Uint64(1709294400), ""},
+		{"iso8601", "layout: DateTime\ntimezone: Europe/Vienna\ntimestampOutput: iso8601", "2024-03-01 12:00:00", mmdbtype.String("2024-03-01T11:00:00Z"), ""},
+		{"no matching layout", "layout: [DateOnly, unix]", "01/03/2024", nil, "doesn't match any of the layouts"},
+		{"before epoch", "layout: DateOnly", "1969-12-31", nil, "is before the Unix epoch"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := NewFieldMapper(testFieldConfig(t, "type: timestamp\n"+test.field))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := m.Map(test.input)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %v, error %v, want error %q", got, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
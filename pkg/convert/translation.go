@@ -0,0 +1,130 @@
+package convert
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	TranslateModePassthrough = "passthrough"
+	TranslateModeDefault     = "default"
+	TranslateModeOmitValue   = "omitValue"
+	TranslateModeOmitRecord  = "omitRecord"
+	TranslateModeError       = "error"
+)
+
+// TranslationTable maps source values to target values. In the config file
+// it is either given inline as a mapping, or as the path of a file
+// containing the table. Supported file formats are two-column CSV, YAML and
+// JSON, detected by file extension.
+type TranslationTable struct {
+	File   string
+	Values map[string]string
+}
+
+func (t *TranslationTable) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&t.File)
+	}
+	return value.Decode(&t.Values)
+}
+
+// translationLoader loads translation table files, relative to the config
+// file's directory. Each file is only read once, even if referenced by
+// multiple fields.
+type translationLoader struct {
+	baseDir string
+	tables  map[string]map[string]string
+}
+
+func newTranslationLoader(baseDir string) *translationLoader {
+	return &translationLoader{
+		baseDir: baseDir,
+		tables:  map[string]map[string]string{},
+	}
+}
+
+func (l *translationLoader) Load(t *TranslationTable) error {
+	if t == nil || t.File == "" {
+		return nil
+	}
+
+	path := t.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(l.baseDir, path)
+	}
+
+	if values, ok := l.tables[path]; ok {
+		t.Values = values
+		return nil
+	}
+
+	values, err := readTranslationFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "error reading translation file (%s)", t.File)
+	}
+	l.tables[path] = values
+	t.Values = values
+	return nil
+}
+
+func readTranslationFile(path string) (map[string]string, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint: gosec
+
+	values := map[string]string{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = 2
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			values[record[0]] = record[1]
+		}
+	case ".yml", ".yaml":
+		if err := yaml.NewDecoder(file).Decode(&values); err != nil {
+			return nil, err
+		}
+	case ".json":
+		// numbers and booleans are translated to their JSON representation,
+		// e.g. to translate names to IDs
+		decoder := json.NewDecoder(file)
+		decoder.UseNumber()
+		var raw map[string]interface{}
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+		for k, v := range raw {
+			switch t := v.(type) {
+			case string:
+				values[k] = t
+			case json.Number:
+				values[k] = t.String()
+			case bool:
+				values[k] = strconv.FormatBool(t)
+			default:
+				return nil, fmt.Errorf("translation of '%s' must be a string, number or boolean", k)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported translation file type '%s'", filepath.Ext(path))
+	}
+	return values, nil
+}
@@ -0,0 +1,51 @@
+package convert
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// removeMarks removes nonspacing marks, i.e. accents and the like, from
+// decomposed strings. It holds no state, so it may be used concurrently.
+var removeMarks = runes.Remove(runes.In(unicode.Mn))
+
+// asciiReplacements holds ASCII replacements for letters and punctuation
+// that don't decompose into an ASCII base character and marks.
+var asciiReplacements = map[rune]string{
+	'ß': "ss", 'ẞ': "SS",
+	'æ': "ae", 'Æ': "AE",
+	'œ': "oe", 'Œ': "OE",
+	'ø': "o", 'Ø': "O",
+	'ł': "l", 'Ł': "L",
+	'đ': "d", 'Đ': "D",
+	'ð': "d", 'Ð': "D",
+	'þ': "th", 'Þ': "Th",
+	'ı': "i",
+	'‘': "'", '’': "'", '‚': "'",
+	'“': "\"", '”': "\"", '„': "\"",
+	'–': "-", '—': "-",
+}
+
+// transliterate converts `s` to ASCII. Accents are stripped from letters,
+// some letters are replaced by their common ASCII spelling, and any other
+// non-ASCII characters are removed.
+func transliterate(s string) string {
+	s, _, _ = transform.String(removeMarks, norm.NFD.String(s))
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if r <= unicode.MaxASCII {
+			b.WriteRune(r)
+		} else if repl, ok := asciiReplacements[r]; ok {
+			b.WriteString(repl)
+		} else if unicode.IsSpace(r) {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,300 @@
+package convert
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fholzer/csv2mmdb/pkg/convert/internal/valuecache"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/pkg/errors"
+)
+
+// treeRecordSize is the record size of the databases written by treeWriter,
+// which is mmdbwriter's default, as used in the normal mode.
+const treeRecordSize = 28
+
+// Kinds of the records of the nodes written to a treeWriter's temporary
+// file. The kind is held by the upper bits of a record, the value by the
+// lower ones.
+const (
+	treeRecordEmpty uint64 = iota << 62
+	treeRecordNode
+	treeRecordData
+
+	treeRecordValueMask = 1<<62 - 1
+)
+
+// treeNodeSize is the size of a node in a treeWriter's temporary file.
+const treeNodeSize = 16
+
+var dataSectionSeparator = make([]byte, 16)
+
+// treeWriter writes an IPv4 database from non-overlapping ranges, passed to
+// Insert in ascending order, without holding the search tree in memory.
+//
+// The ranges are split into networks, which are the leaves of the tree.
+// Nodes are completed in post-order, and written to a temporary file, along
+// with the post-order number of their child nodes. Once all nodes were
+// written, they're copied to the database in reverse order, so the root
+// becomes node 0. Records are written to the data section when they're first
+// referenced, so memory usage only depends on the number and size of the
+// distinct records.
+type treeWriter struct {
+	databaseType string
+	languages    []string
+	records      *valuecache.RecordStore
+	data         *valuecache.DataWriter
+	// offsets holds the offset of each record within the data section plus
+	// one, or zero if it hasn't been written yet
+	offsets []uint32
+
+	file  *os.File
+	nodes *bufio.Writer
+	// nodeCount is the number of nodes written
+	nodeCount uint64
+	// stack holds the nodes whose subtrees are being written, the root
+	// first. Each node's children are filled left to right.
+	stack []treeNode
+	// pos is the first address not covered by the leaves inserted so far
+	pos uint64
+}
+
+// treeNode is a node whose subtree is being written.
+type treeNode struct {
+	children [2]uint64
+	// filled is the number of children filled
+	filled int
+}
+
+func newTreeWriter(config *Config, records *valuecache.RecordStore, tempDir string) (*treeWriter, error) {
+	file, err := os.CreateTemp(tempDir, "csv2mmdb-*.tree")
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating temporary file")
+	}
+	return &treeWriter{
+		databaseType: config.DatabaseType,
+		languages:    config.Languages,
+		records:      records,
+		data:         valuecache.NewDataWriter(),
+		offsets:      make([]uint32, records.Len()),
+		file:         file,
+		nodes:        bufio.NewWriter(file),
+		stack:        []treeNode{{}},
+	}, nil
+}
+
+// Insert inserts the record with ID `id` for the range from `start` to `end`,
+// which must follow the ranges inserted before. Addresses between ranges
+// remain empty.
+func (w *treeWriter) Insert(start uint32, end uint32, id uint32) error {
+	if err := w.fill(uint64(start), treeRecordEmpty); err != nil {
+		return err
+	}
+
+	if w.offsets[id] == 0 {
+		offset, err := w.data.WriteRecord(w.records.Get(id))
+		if err != nil {
+			return errors.Wrap(err, "error writing data section")
+		}
+		w.offsets[id] = uint32(offset) + 1
+	}
+	return w.fill(uint64(end)+1, treeRecordData|uint64(w.offsets[id]-1))
+}
+
+// fill covers the addresses from `pos` up to, but excluding, `until` with
+// leaves holding the record `record`. Each leaf is the largest network
+// starting at `pos` which fits, which results in the least number of nodes.
+func (w *treeWriter) fill(until uint64, record uint64) error {
+	for w.pos < until {
+		// networks are at most /1, so the root is always a node
+		size := uint64(1) << 31
+		for w.pos%size != 0 || w.pos+size > until {
+			size >>= 1
+		}
+		depth := 32
+		for s := size; s > 1; s >>= 1 {
+			depth--
+		}
+		if err := w.addLeaf(depth, record); err != nil {
+			return err
+		}
+		w.pos += size
+	}
+	return nil
+}
+
+// addLeaf adds a leaf at depth `depth`, holding `record`, as the next child in
+// the tree.
+func (w *treeWriter) addLeaf(depth int, record uint64) error {
+	// descend to the parent of the leaf. Since leaves are added in order, the
+	// leaf is within the next child of the innermost node.
+	for len(w.stack) < depth {
+		w.stack = append(w.stack, treeNode{})
+	}
+
+	for {
+		n := &w.stack[len(w.stack)-1]
+		n.children[n.filled] = record
+		n.filled++
+		if n.filled < 2 {
+			return nil
+		}
+
+		// the node is complete
+		var b [treeNodeSize]byte
+		binary.BigEndian.PutUint64(b[0:], n.children[0])
+		binary.BigEndian.PutUint64(b[8:], n.children[1])
+		if _, err := w.nodes.Write(b[:]); err != nil {
+			return errors.Wrapf(err, "error writing temporary file (%s)", w.file.Name())
+		}
+		record = treeRecordNode | w.nodeCount
+		w.nodeCount++
+		w.stack = w.stack[:len(w.stack)-1]
+		if len(w.stack) == 0 {
+			return nil
+		}
+	}
+}
+
+// NodeCount returns the number of nodes of the search tree.
+func (w *treeWriter) NodeCount() uint64 {
+	return w.nodeCount
+}
+
+// WriteTo writes the database to `out`. Addresses following the last range
+// inserted remain empty.
+func (w *treeWriter) WriteTo(out io.Writer) (int64, error) {
+	if err := w.fill(1<<32, treeRecordEmpty); err != nil {
+		return 0, err
+	}
+	if err := w.nodes.Flush(); err != nil {
+		return 0, errors.Wrapf(err, "error writing temporary file (%s)", w.file.Name())
+	}
+
+	buf := bufio.NewWriter(out)
+	n, err := w.writeTree(buf)
+	if err != nil {
+		return n, err
+	}
+
+	nb, err := buf.Write(dataSectionSeparator)
+	n += int64(nb)
+	if err != nil {
+		return n, err
+	}
+	nb64, err := w.data.WriteTo(buf)
+	n += nb64
+	if err != nil {
+		return n, err
+	}
+
+	nb, err = buf.Write(metadataStartMarker)
+	n += int64(nb)
+	if err != nil {
+		return n, err
+	}
+	nb64, err = w.metadata().WriteTo(metadataWriter{buf})
+	n += nb64
+	if err != nil {
+		return n, errors.Wrap(err, "error writing metadata")
+	}
+
+	return n, buf.Flush()
+}
+
+// writeTree copies the nodes from the temporary file to `out`, in reverse
+// order.
+func (w *treeWriter) writeTree(out io.Writer) (int64, error) {
+	maxRecord := uint64(1) << treeRecordSize
+	recordValue := func(r uint64) (uint64, error) {
+		var v uint64
+		switch r &^ treeRecordValueMask {
+		case treeRecordNode:
+			v = w.nodeCount - 1 - r&treeRecordValueMask
+		case treeRecordData:
+			v = w.nodeCount + uint64(len(dataSectionSeparator)) + r&treeRecordValueMask
+		default:
+			v = w.nodeCount
+		}
+		if v >= maxRecord {
+			return 0, fmt.Errorf("exceeded record capacity by attempting to write %d to node with %d bit record size", v, treeRecordSize)
+		}
+		return v, nil
+	}
+
+	var n int64
+	chunk := make([]byte, 4096*treeNodeSize)
+	node := make([]byte, 2*treeRecordSize/8)
+	for end := int64(w.nodeCount) * treeNodeSize; end > 0; {
+		start := end - int64(len(chunk))
+		if start < 0 {
+			start = 0
+		}
+		b := chunk[:end-start]
+		if _, err := w.file.ReadAt(b, start); err != nil {
+			return n, errors.Wrapf(err, "error reading temporary file (%s)", w.file.Name())
+		}
+		end = start
+
+		for i := len(b) - treeNodeSize; i >= 0; i -= treeNodeSize {
+			left, err := recordValue(binary.BigEndian.Uint64(b[i:]))
+			if err != nil {
+				return n, err
+			}
+			right, err := recordValue(binary.BigEndian.Uint64(b[i+8:]))
+			if err != nil {
+				return n, err
+			}
+			node[0] = byte(left >> 16)
+			node[1] = byte(left >> 8)
+			node[2] = byte(left)
+			node[3] = byte((left>>24)<<4 | right>>24&0x0F)
+			node[4] = byte(right >> 16)
+			node[5] = byte(right >> 8)
+			node[6] = byte(right)
+			nb, err := out.Write(node)
+			n += int64(nb)
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *treeWriter) metadata() mmdbtype.Map {
+	languages := mmdbtype.Slice{}
+	for _, l := range w.languages {
+		languages = append(languages, mmdbtype.String(l))
+	}
+	return mmdbtype.Map{
+		"binary_format_major_version": mmdbtype.Uint16(2),
+		"binary_format_minor_version": mmdbtype.Uint16(0),
+		"build_epoch":                 mmdbtype.Uint64(time.Now().Unix()),
+		"database_type":               mmdbtype.String(w.databaseType),
+		"description":                 mmdbtype.Map{},
+		"ip_version":                  mmdbtype.Uint16(4),
+		"languages":                   languages,
+		"node_count":                  mmdbtype.Uint32(w.nodeCount),
+		"record_size":                 mmdbtype.Uint16(treeRecordSize),
+	}
+}
+
+// Close removes the temporary file.
+func (w *treeWriter) Close() {
+	w.file.Close()           //nolint: gosec
+	os.Remove(w.file.Name()) //nolint: gosec
+}
+
+// metadataWriter writes the metadata, which must not contain pointers.
+type metadataWriter struct {
+	*bufio.Writer
+}
+
+func (w metadataWriter) WriteOrWritePointer(t mmdbtype.DataType) (int64, error) {
+	return t.WriteTo(w)
+}